@@ -0,0 +1,70 @@
+package eidas
+
+import (
+	"crypto"
+	"encoding/asn1"
+	"errors"
+	"sync"
+
+	"github.com/apple/eidas/qcstatements"
+)
+
+// CSRRequest describes one certificate signing request for GenerateCSRBatch.
+type CSRRequest struct {
+	CountryCode string
+	OrgName     string
+	OrgID       string
+	CommonName  string
+	Roles       []qcstatements.Role
+	// QCType should be one of qcstatements.QSEALType or qcstatements.QWACType.
+	QCType asn1.ObjectIdentifier
+	// Key signs the CSR. If nil, a key of the given Algorithm is generated.
+	Key       crypto.Signer
+	Algorithm KeyAlgorithm
+	Options   []CertificateOption
+}
+
+// Result is the outcome of one CSRRequest.
+type Result struct {
+	CSR []byte
+	// Key is the request's key, or the generated one if it had none.
+	Key crypto.Signer
+	Err error
+}
+
+// GenerateCSRBatch builds a certificate signing request for each of reqs using
+// up to workers goroutines. The results are in the same order as reqs, each
+// with its own error. Any rand source set with WithRandSource must be safe for
+// concurrent use.
+func GenerateCSRBatch(reqs []CSRRequest, workers int) ([]Result, error) {
+	if workers < 1 {
+		return nil, errors.New("eidas: workers must be at least 1")
+	}
+	results := make([]Result, len(reqs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(reqs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = generateBatchCSR(reqs[i])
+			}
+		}()
+	}
+	for i := range reqs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results, nil
+}
+
+func generateBatchCSR(req CSRRequest) Result {
+	if req.Key == nil {
+		csr, key, err := GenerateCSRWithAlgorithm(req.Algorithm, req.CountryCode, req.OrgName, req.OrgID, req.CommonName, req.Roles, req.QCType, req.Options...)
+		return Result{CSR: csr, Key: key, Err: err}
+	}
+	csr, err := GenerateCSRWithKey(req.CountryCode, req.OrgName, req.OrgID, req.CommonName, req.Roles, req.QCType, req.Key, req.Options...)
+	return Result{CSR: csr, Key: req.Key, Err: err}
+}
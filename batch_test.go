@@ -0,0 +1,60 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"fmt"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerateCSRBatch(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("100 CSRs in order", t, func() {
+		var reqs []CSRRequest
+		for i := 0; i < 100; i++ {
+			reqs = append(reqs, CSRRequest{
+				CountryCode: "GB",
+				OrgName:     "Foo Org",
+				OrgID:       "PSDGB-FCA-123456",
+				CommonName:  fmt.Sprintf("Foo Name %d", i),
+				Roles:       roles,
+				QCType:      qcstatements.QSEALType,
+				Algorithm:   ECP256,
+			})
+		}
+		results, err := GenerateCSRBatch(reqs, 8)
+		So(err, ShouldBeNil)
+		So(results, ShouldHaveLength, len(reqs))
+		for i, r := range results {
+			So(r.Err, ShouldBeNil)
+			csr, err := x509.ParseCertificateRequest(r.CSR)
+			So(err, ShouldBeNil)
+			So(csr.CheckSignature(), ShouldBeNil)
+			So(csr.Subject.CommonName, ShouldEqual, reqs[i].CommonName)
+			So(r.Key.Public(), ShouldResemble, csr.PublicKey)
+		}
+	})
+
+	Convey("existing key and per-request errors", t, func() {
+		key, err := GenerateKey(ECP256)
+		So(err, ShouldBeNil)
+		reqs := []CSRRequest{
+			{CountryCode: "GB", OrgName: "Foo Org", OrgID: "PSDGB-FCA-123456", CommonName: "Foo Name", Roles: roles, QCType: qcstatements.QSEALType, Key: key},
+			{CountryCode: "XX", OrgName: "Foo Org", OrgID: "PSDGB-FCA-123456", CommonName: "Foo Name", Roles: roles, QCType: qcstatements.QSEALType, Key: key},
+		}
+		results, err := GenerateCSRBatch(reqs, 4)
+		So(err, ShouldBeNil)
+		So(results[0].Err, ShouldBeNil)
+		So(results[0].Key, ShouldEqual, key)
+		So(results[1].Err, ShouldNotBeNil)
+		So(results[1].CSR, ShouldBeNil)
+	})
+
+	Convey("no workers", t, func() {
+		_, err := GenerateCSRBatch(nil, 0)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,290 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/apple/eidas/qcstatements"
+)
+
+// defaultValidity is the validity period of generated certificates unless
+// overridden with WithValidity.
+const defaultValidity = 365 * 24 * time.Hour
+
+// WithValidity sets the validity period of generated certificates. Defaults to
+// one year from the time of generation. It has no effect on CSRs.
+func WithValidity(notBefore, notAfter time.Time) CertificateOption {
+	return func(o *certificateOptions) {
+		if !notBefore.Before(notAfter) {
+			o.err = errors.New("eidas: notBefore must be before notAfter")
+			return
+		}
+		o.notBefore = notBefore
+		o.notAfter = notAfter
+	}
+}
+
+// WithSerialNumber sets the serial number of generated certificates, which must
+// be positive. Defaults to a random 128-bit serial number. It has no effect on
+// CSRs.
+func WithSerialNumber(serial *big.Int) CertificateOption {
+	return func(o *certificateOptions) {
+		if serial == nil || serial.Sign() <= 0 {
+			o.err = errors.New("eidas: serial number must be positive")
+			return
+		}
+		o.certSerial = new(big.Int).Set(serial)
+	}
+}
+
+// WithAuthorityKeyIdentifier sets whether generated self-signed certificates
+// include an authorityKeyIdentifier extension, which equals the subject key
+// identifier. Defaults to false. It has no effect on CSRs.
+func WithAuthorityKeyIdentifier(enabled bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.aki = enabled
+	}
+}
+
+// WithBasicConstraints adds a critical basicConstraints extension to generated
+// certificates, e.g. to build test CA chains. maxPathLen limits the number of
+// intermediate CAs below a CA certificate, where -1 means no limit, and must be
+// 0 or -1 unless isCA is true. Self-signed CA certificates additionally get
+// the keyCertSign and cRLSign key usages. It has no effect on CSRs.
+func WithBasicConstraints(isCA bool, maxPathLen int) CertificateOption {
+	return func(o *certificateOptions) {
+		if maxPathLen < -1 {
+			o.err = errors.New("eidas: maxPathLen must be at least -1")
+			return
+		}
+		if !isCA && maxPathLen > 0 {
+			o.err = errors.New("eidas: maxPathLen only applies to CA certificates")
+			return
+		}
+		o.basicConstraints = true
+		o.isCA = isCA
+		o.maxPathLen = maxPathLen
+	}
+}
+
+// WithPermittedDNSDomains adds the given domains, e.g. "example.com", to the
+// permitted subtrees of a critical nameConstraints extension in generated CA
+// certificates. Certificates below the CA must only have DNS names within
+// them. It requires WithBasicConstraints with isCA true and has no effect on
+// CSRs.
+func WithPermittedDNSDomains(domains []string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.permittedDNSDomains = append(o.permittedDNSDomains, domains...)
+	}
+}
+
+// WithExcludedDNSDomains adds the given domains to the excluded subtrees of a
+// critical nameConstraints extension in generated CA certificates.
+// Certificates below the CA must not have DNS names within them. It requires
+// WithBasicConstraints with isCA true and has no effect on CSRs.
+func WithExcludedDNSDomains(domains []string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.excludedDNSDomains = append(o.excludedDNSDomains, domains...)
+	}
+}
+
+// GenerateSelfSignedCert builds a self-signed certificate for an organization
+// with the same subject and extensions as GenerateCSRWithKey would request.
+// This is intended for testing.
+// qcType should be one of qcstatements.QSEALType or qcstatements.QWACType.
+func GenerateSelfSignedCert(
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, opts ...CertificateOption) ([]byte, error) {
+	o := newCertificateOptions(opts)
+	req, err := buildRequest(countryCode, orgName, orgID, commonName, roles, qcType, priv, o)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := certificateTemplate(o)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.RawSubject = req.RawSubject
+	tmpl.SignatureAlgorithm = req.SignatureAlgorithm
+	tmpl.ExtraExtensions = req.ExtraExtensions
+	tmpl.DNSNames = req.DNSNames
+	if o.isCA {
+		usages, err := keyUsageForType(qcType)
+		if err != nil {
+			return nil, err
+		}
+		keyUsageExt := keyUsageExtension(append(usages, x509.KeyUsageCertSign, x509.KeyUsageCRLSign))
+		keyUsageExt.Critical = o.keyUsageCritical
+		for i, ext := range tmpl.ExtraExtensions {
+			if ext.Id.Equal(oidExtensionKeyUsage) {
+				tmpl.ExtraExtensions[i] = keyUsageExt
+			}
+		}
+	}
+	if o.aki {
+		ski, err := subjectKeyIdentifier(priv.Public(), o.skiHash)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := asn1.Unmarshal(ski.Value, &tmpl.AuthorityKeyId); err != nil {
+			return nil, fmt.Errorf("failed to parse subject key identifier: %v", err)
+		}
+	}
+
+	cert, err := x509.CreateCertificate(o.rand, tmpl, tmpl, priv.Public(), priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// SignCSR issues a certificate for a DER encoded CSR, signed by the given CA
+// certificate and key. The certificate copies the subject, public key, DNS
+// names and requested extensions from the CSR. This is intended for testing.
+func SignCSR(csrDER []byte, caCert *x509.Certificate, caKey crypto.Signer, opts ...CertificateOption) ([]byte, error) {
+	o := newCertificateOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csr: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid csr signature: %v", err)
+	}
+
+	tmpl, err := certificateTemplate(o)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.RawSubject = csr.RawSubject
+	tmpl.ExtraExtensions = csr.Extensions
+	tmpl.DNSNames = csr.DNSNames
+
+	cert, err := x509.CreateCertificate(o.rand, tmpl, caCert, csr.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate: %v", err)
+	}
+	return cert, nil
+}
+
+// Extensions copied from a certificate by CSRFromCertificate.
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionSubjectKeyID     = asn1.ObjectIdentifier{2, 5, 29, 14}
+)
+
+// CSRFromCertificate builds a renewal CSR signed by priv that reproduces the
+// subject, subject alternative names, key usages and qualified statements of
+// cert exactly. The subject key identifier is computed from priv's public key.
+// It returns ErrNoQCStatements if cert has no qcStatements extension.
+func CSRFromCertificate(cert *x509.Certificate, priv crypto.Signer) ([]byte, error) {
+	if priv == nil {
+		return nil, ErrNilSigner
+	}
+	pubKeyAlgo, err := publicKeyAlgorithm(priv.Public())
+	if err != nil {
+		return nil, err
+	}
+	if findQCStatements(cert.Extensions) == nil {
+		return nil, ErrNoQCStatements
+	}
+	ski, err := subjectKeyIdentifier(priv.Public(), crypto.SHA1)
+	if err != nil {
+		return nil, err
+	}
+
+	var extensions []pkix.Extension
+	hasSKI := false
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionSubjectKeyID):
+			extensions = append(extensions, ski)
+			hasSKI = true
+		case ext.Id.Equal(oidExtensionKeyUsage),
+			ext.Id.Equal(oidExtensionExtendedKeyUsage),
+			ext.Id.Equal(oidExtensionSubjectAltName),
+			ext.Id.Equal(QCStatementsExt):
+			extensions = append(extensions, ext)
+		}
+	}
+	if !hasSKI {
+		extensions = append(extensions, ski)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		RawSubject:         cert.RawSubject,
+		SignatureAlgorithm: defaultSignatureAlgorithm(pubKeyAlgo),
+		PublicKeyAlgorithm: pubKeyAlgo,
+		ExtraExtensions:    extensions,
+	}, priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate csr: %v", err)
+	}
+	return csr, nil
+}
+
+// certificateTemplate returns a certificate template with the serial number
+// and validity period set from the options.
+func certificateTemplate(o *certificateOptions) (*x509.Certificate, error) {
+	serial := o.certSerial
+	if serial == nil {
+		var err error
+		serial, err = randomSerialNumber(o.rand)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate serial number: %v", err)
+		}
+	}
+	notBefore, notAfter := o.notBefore, o.notAfter
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+		notAfter = notBefore.Add(defaultValidity)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	if o.basicConstraints {
+		tmpl.BasicConstraintsValid = true
+		tmpl.IsCA = o.isCA
+		if o.isCA {
+			tmpl.MaxPathLen = o.maxPathLen
+			tmpl.MaxPathLenZero = o.maxPathLen == 0
+		}
+	}
+	if len(o.permittedDNSDomains) != 0 || len(o.excludedDNSDomains) != 0 {
+		if !o.isCA {
+			return nil, errors.New("eidas: name constraints require a CA certificate")
+		}
+		tmpl.PermittedDNSDomainsCritical = true
+		tmpl.PermittedDNSDomains = o.permittedDNSDomains
+		tmpl.ExcludedDNSDomains = o.excludedDNSDomains
+	}
+	return tmpl, nil
+}
+
+// randomSerialNumber returns a random positive serial number of up to 128 bits.
+func randomSerialNumber(r io.Reader) (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	for {
+		serial, err := rand.Int(r, limit)
+		if err != nil {
+			return nil, err
+		}
+		if serial.Sign() > 0 {
+			return serial, nil
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerateSelfSignedCert(t *testing.T) {
+	Convey("self-signed QWAC", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithDNSName("foo.example.com"))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature), ShouldBeNil)
+		So(cert.Subject.CommonName, ShouldEqual, "Foo Name")
+		So(cert.DNSNames, ShouldResemble, []string{"foo.example.com"})
+		So(cert.SerialNumber.Sign(), ShouldEqual, 1)
+		So(ValidateConsistency(cert), ShouldBeNil)
+	})
+
+	Convey("self-signed cert with validity", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		notAfter := time.Date(2021, 6, 30, 12, 0, 0, 0, time.UTC)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, key, WithValidity(notBefore, notAfter))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.NotBefore, ShouldEqual, notBefore)
+		So(cert.NotAfter, ShouldEqual, notAfter)
+	})
+
+	Convey("invalid validity", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		now := time.Now()
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, key, WithValidity(now, now.Add(-time.Hour)))
+		So(err, ShouldBeError, "eidas: notBefore must be before notAfter")
+		So(der, ShouldBeNil)
+	})
+}
+
+func TestSerialNumber(t *testing.T) {
+	Convey("self-signed cert with serial number", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithSerialNumber(big.NewInt(42)), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.SerialNumber.Int64(), ShouldEqual, 42)
+	})
+
+	Convey("signed CSR with serial number", t, func() {
+		caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		caTmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "Test CA"},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+		So(err, ShouldBeNil)
+		caCert, err := x509.ParseCertificate(caDER)
+		So(err, ShouldBeNil)
+
+		csr, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		der, err := SignCSR(csr, caCert, caKey, WithSerialNumber(big.NewInt(1234)))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.SerialNumber.Int64(), ShouldEqual, 1234)
+		So(cert.CheckSignatureFrom(caCert), ShouldBeNil)
+		So(cert.Subject.CommonName, ShouldEqual, "Foo Name")
+		So(ValidateConsistency(cert), ShouldBeNil)
+	})
+
+	Convey("nil and zero serial numbers are rejected", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		for _, serial := range []*big.Int{nil, big.NewInt(0), big.NewInt(-1)} {
+			der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithSerialNumber(serial), WithDNSName("example.com"))
+			So(err, ShouldBeError, "eidas: serial number must be positive")
+			So(der, ShouldBeNil)
+		}
+	})
+}
+
+func TestAuthorityKeyIdentifier(t *testing.T) {
+	Convey("self-signed cert with authority key identifier", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, key, WithAuthorityKeyIdentifier(true))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.SubjectKeyId, ShouldNotBeEmpty)
+		So(cert.AuthorityKeyId, ShouldResemble, cert.SubjectKeyId)
+	})
+
+	Convey("self-signed cert without authority key identifier", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, key)
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.AuthorityKeyId, ShouldBeEmpty)
+	})
+}
+
+func TestCSRFromCertificate(t *testing.T) {
+	Convey("renewal CSR from a certificate", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		roles := []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation}
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, key, WithDNSName("foo.example.com"), WithTransactionLimit(qcstatements.MonetaryLimit{Amount: 100, Currency: "EUR"}))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+
+		newKey, err := GenerateKey(ECP256)
+		So(err, ShouldBeNil)
+		data, err := CSRFromCertificate(cert, newKey)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.CheckSignature(), ShouldBeNil)
+		So(csr.RawSubject, ShouldResemble, cert.RawSubject)
+		So(csr.DNSNames, ShouldResemble, cert.DNSNames)
+		So(findQCStatements(csr.Extensions), ShouldResemble, findQCStatements(cert.Extensions))
+
+		ski, err := subjectKeyIdentifier(newKey.Public(), crypto.SHA1)
+		So(err, ShouldBeNil)
+		So(csr.Extensions, ShouldContain, ski)
+	})
+
+	Convey("certificate without qcStatements", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "Foo Name"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		data, err := CSRFromCertificate(cert, key)
+		So(err, ShouldEqual, ErrNoQCStatements)
+		So(data, ShouldBeNil)
+	})
+}
+
+func TestBasicConstraints(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("CA cert with path length", t, func() {
+		caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo CA", "Foo CA ID", "Foo CA", roles, qcstatements.QSEALType, caKey, WithBasicConstraints(true, 0))
+		So(err, ShouldBeNil)
+		caCert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(caCert.BasicConstraintsValid, ShouldBeTrue)
+		So(caCert.IsCA, ShouldBeTrue)
+		So(caCert.MaxPathLen, ShouldEqual, 0)
+		So(caCert.MaxPathLenZero, ShouldBeTrue)
+		So(caCert.KeyUsage&x509.KeyUsageCertSign, ShouldNotEqual, 0)
+
+		Convey("issues a leaf which verifies", func() {
+			csr, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType)
+			So(err, ShouldBeNil)
+			der, err := SignCSR(csr, caCert, caKey)
+			So(err, ShouldBeNil)
+			leaf, err := x509.ParseCertificate(der)
+			So(err, ShouldBeNil)
+			So(leaf.BasicConstraintsValid, ShouldBeFalse)
+			roots := x509.NewCertPool()
+			roots.AddCert(caCert)
+			_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("CA cert without path length limit", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo CA", "Foo CA ID", "Foo CA", roles, qcstatements.QSEALType, key, WithBasicConstraints(true, -1))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.IsCA, ShouldBeTrue)
+		So(cert.MaxPathLen, ShouldEqual, -1)
+	})
+
+	Convey("end entity cert", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, key, WithBasicConstraints(false, 0))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.BasicConstraintsValid, ShouldBeTrue)
+		So(cert.IsCA, ShouldBeFalse)
+	})
+
+	Convey("path length without CA", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, key, WithBasicConstraints(false, 1))
+		So(err, ShouldBeError, "eidas: maxPathLen only applies to CA certificates")
+		So(der, ShouldBeNil)
+	})
+}
+
+func TestNameConstraints(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("CA cert with name constraints", t, func() {
+		caKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo CA", "Foo CA ID", "Foo CA", roles, qcstatements.QSEALType, caKey,
+			WithBasicConstraints(true, 0), WithPermittedDNSDomains([]string{"example.com"}), WithExcludedDNSDomains([]string{"bad.example.com"}))
+		So(err, ShouldBeNil)
+		caCert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(caCert.PermittedDNSDomainsCritical, ShouldBeTrue)
+		So(caCert.PermittedDNSDomains, ShouldResemble, []string{"example.com"})
+		So(caCert.ExcludedDNSDomains, ShouldResemble, []string{"bad.example.com"})
+		So(caCert.Extensions, shouldContainID, asn1.ObjectIdentifier{2, 5, 29, 30})
+
+		roots := x509.NewCertPool()
+		roots.AddCert(caCert)
+		verify := func(dnsName string) error {
+			csr, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName(dnsName))
+			So(err, ShouldBeNil)
+			der, err := SignCSR(csr, caCert, caKey)
+			So(err, ShouldBeNil)
+			leaf, err := x509.ParseCertificate(der)
+			So(err, ShouldBeNil)
+			_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+			return err
+		}
+
+		Convey("a leaf within the permitted domains verifies", func() {
+			So(verify("www.example.com"), ShouldBeNil)
+		})
+
+		Convey("a leaf outside the permitted domains fails", func() {
+			So(verify("example.org"), ShouldNotBeNil)
+		})
+
+		Convey("a leaf within the excluded domains fails", func() {
+			So(verify("www.bad.example.com"), ShouldNotBeNil)
+		})
+	})
+
+	Convey("name constraints without CA", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, key, WithPermittedDNSDomains([]string{"example.com"}))
+		So(err, ShouldBeError, "eidas: name constraints require a CA certificate")
+		So(der, ShouldBeNil)
+	})
+}
@@ -0,0 +1,219 @@
+// Command eidas-csr generates eIDAS QWAC and QSEAL certificate signing requests.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/apple/eidas"
+	"github.com/apple/eidas/qcstatements"
+)
+
+// stdoutPath is the output path which writes to stdout instead of a file.
+const stdoutPath = "-"
+
+type config struct {
+	countryCode string
+	orgName     string
+	orgID       string
+	commonName  string
+	roles       []qcstatements.Role
+	qcType      asn1.ObjectIdentifier
+	keySize     int
+	keyPath     string
+	csrOut      string
+	keyOut      string
+	dnsNames    []string
+}
+
+func parseFlags(args []string) (*config, error) {
+	fs := flag.NewFlagSet("eidas-csr", flag.ContinueOnError)
+	countryCode := fs.String("country", "", "ISO-3166-1 Alpha 2 country code, e.g. 'GB'")
+	orgName := fs.String("org", "", "Organization name")
+	orgID := fs.String("org-id", "", "Organization ID, e.g. 'PSDGB-FCA-123456'")
+	commonName := fs.String("common-name", "", "Common Name")
+	roles := fs.String("roles", "AIS", "eIDAS roles; comma-separated list from [AIS, PIS, ASPSP, PIISP]")
+	qcType := fs.String("type", "qwac", "Certificate type; one of qwac or qseal")
+	keySize := fs.Int("key-size", 2048, "RSA key size in bits")
+	keyPath := fs.String("key", "", "Existing PEM encoded RSA private key to use instead of generating one")
+	csrOut := fs.String("csr-out", "out.csr", "Output file for CSR, or '-' for stdout")
+	keyOut := fs.String("key-out", "out.key", "Output file for generated private key, or '-' for stdout")
+	dnsNames := fs.String("dns-names", "", "Comma separated list of domain names to add as Subject Alternate Names")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *countryCode == "" {
+		return nil, errors.New("-country is required")
+	}
+	if *orgName == "" {
+		return nil, errors.New("-org is required")
+	}
+	if *orgID == "" {
+		return nil, errors.New("-org-id is required")
+	}
+	if *commonName == "" {
+		return nil, errors.New("-common-name is required")
+	}
+
+	cfg := &config{
+		countryCode: *countryCode,
+		orgName:     *orgName,
+		orgID:       *orgID,
+		commonName:  *commonName,
+		keySize:     *keySize,
+		keyPath:     *keyPath,
+		csrOut:      *csrOut,
+		keyOut:      *keyOut,
+	}
+
+	t, err := typeFromFlag(*qcType)
+	if err != nil {
+		return nil, err
+	}
+	cfg.qcType = t
+
+	for _, name := range strings.Split(*roles, ",") {
+		r, err := qcstatements.RoleFromString(name)
+		if err != nil {
+			return nil, err
+		}
+		cfg.roles = append(cfg.roles, r)
+	}
+
+	if *dnsNames != "" {
+		for _, name := range strings.Split(*dnsNames, ",") {
+			cfg.dnsNames = append(cfg.dnsNames, strings.TrimSpace(name))
+		}
+	}
+	return cfg, nil
+}
+
+func typeFromFlag(in string) (asn1.ObjectIdentifier, error) {
+	switch strings.ToLower(in) {
+	case "qwac":
+		return qcstatements.QWACType, nil
+	case "qseal":
+		return qcstatements.QSEALType, nil
+	}
+	return nil, fmt.Errorf("unknown QC type: %s", in)
+}
+
+func readKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", key)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("unsupported PEM block type: %s", block.Type)
+}
+
+func writePEM(path string, stdout io.Writer, block *pem.Block, perm os.FileMode) (err error) {
+	if path == stdoutPath {
+		return pem.Encode(stdout, block)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err2 := f.Close(); err2 != nil {
+			if err == nil {
+				err = err2
+			}
+		}
+	}()
+	return pem.Encode(f, block)
+}
+
+func run(args []string, stdout io.Writer) error {
+	cfg, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+
+	var key crypto.Signer
+	generated := false
+	if cfg.keyPath != "" {
+		key, err = readKey(cfg.keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read key from %s: %v", cfg.keyPath, err)
+		}
+	} else {
+		key, err = rsa.GenerateKey(rand.Reader, cfg.keySize)
+		if err != nil {
+			return fmt.Errorf("failed to generate key pair: %v", err)
+		}
+		generated = true
+	}
+
+	var opts []eidas.CertificateOption
+	for _, name := range cfg.dnsNames {
+		opts = append(opts, eidas.WithDNSName(name))
+	}
+
+	csr, err := eidas.GenerateCSRWithKey(
+		cfg.countryCode, cfg.orgName, cfg.orgID, cfg.commonName, cfg.roles, cfg.qcType, key, opts...)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(cfg.csrOut, stdout, &pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csr,
+	}, 0644); err != nil {
+		return fmt.Errorf("failed to write CSR to %s: %v", cfg.csrOut, err)
+	}
+
+	if !generated {
+		return nil
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(cfg.keyOut, stdout, &pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: pkcs8,
+	}, 0600); err != nil {
+		return fmt.Errorf("failed to write key to %s: %v", cfg.keyOut, err)
+	}
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+)
+
+var requiredArgs = []string{
+	"-country", "GB",
+	"-org", "Foo Org",
+	"-org-id", "PSDGB-FCA-123456",
+	"-common-name", "Foo Name",
+}
+
+func TestParseFlags(t *testing.T) {
+	cfg, err := parseFlags(append(requiredArgs, "-roles", "AIS,pis", "-type", "QSEAL", "-key-size", "4096"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation}
+	if !reflect.DeepEqual(cfg.roles, expected) {
+		t.Errorf("Expected roles: %v but got %v", expected, cfg.roles)
+	}
+	if !cfg.qcType.Equal(qcstatements.QSEALType) {
+		t.Errorf("Expected QSEAL type but got %v", cfg.qcType)
+	}
+	if cfg.keySize != 4096 {
+		t.Errorf("Expected key size 4096 but got %d", cfg.keySize)
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	for name, args := range map[string][]string{
+		"missing country": {"-org", "Foo Org", "-org-id", "PSDGB-FCA-123456", "-common-name", "Foo Name"},
+		"unknown role":    append(requiredArgs, "-roles", "FOO"),
+		"unknown type":    append(requiredArgs, "-type", "qfoo"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseFlags(args); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func readPEM(t *testing.T, path string, blockType string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		t.Fatalf("Expected %s PEM block in %s", blockType, path)
+	}
+	return block.Bytes
+}
+
+func TestRunWritesFiles(t *testing.T) {
+	dir := t.TempDir()
+	csrPath := filepath.Join(dir, "out.csr")
+	keyPath := filepath.Join(dir, "out.key")
+
+	var stdout bytes.Buffer
+	if err := run(append(requiredArgs, "-dns-names", "example.com", "-csr-out", csrPath, "-key-out", keyPath), &stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(readPEM(t, csrPath, "CERTIFICATE REQUEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csr.Subject.CommonName != "Foo Name" {
+		t.Errorf("Expected common name: Foo Name but got %s", csr.Subject.CommonName)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(readPEM(t, keyPath, "PRIVATE KEY"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.(*rsa.PrivateKey).PublicKey.Equal(csr.PublicKey) {
+		t.Error("CSR public key does not match written private key")
+	}
+}
+
+func TestRunExistingKeyToStdout(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "existing.key")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := run(append(requiredArgs, "-dns-names", "example.com", "-key", keyPath, "-csr-out", "-"), &stdout); err != nil {
+		t.Fatal(err)
+	}
+
+	block, rest := pem.Decode(stdout.Bytes())
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		t.Fatal("Expected CSR on stdout")
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		t.Error("Expected no key output when reusing an existing key")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.PublicKey.Equal(csr.PublicKey) {
+		t.Error("CSR public key does not match existing key")
+	}
+}
@@ -0,0 +1,124 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+
+	"github.com/apple/eidas/qcstatements"
+)
+
+// Difference describes a value which differs between a CSR and the
+// certificate issued for it. An empty Requested or Issued value means the
+// value is absent from the CSR or certificate respectively.
+type Difference struct {
+	// Field is the name of the differing value, e.g. "Role" or "CAID".
+	Field     string
+	Requested string
+	Issued    string
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: requested %q but issued %q", d.Field, d.Requested, d.Issued)
+}
+
+type qcSummary struct {
+	roles   []qcstatements.Role
+	caName  string
+	caID    string
+	qcTypes []asn1.ObjectIdentifier
+	orgID   string
+}
+
+func summarize(exts []pkix.Extension, subject pkix.Name) (*qcSummary, error) {
+	qc := findQCStatements(exts)
+	if qc == nil {
+		return nil, ErrNoQCStatements
+	}
+	roles, caName, caID, err := qcstatements.Extract(qc)
+	if err != nil {
+		return nil, err
+	}
+	types, err := qcstatements.ExtractTypes(qc)
+	if err != nil {
+		return nil, err
+	}
+	s := &qcSummary{
+		roles:   roles,
+		caName:  caName,
+		caID:    caID,
+		qcTypes: types,
+	}
+	for _, name := range subject.Names {
+		if name.Type.Equal(oidOrganizationID) {
+			s.orgID = fmt.Sprint(name.Value)
+		}
+	}
+	return s, nil
+}
+
+// CompareQCStatements compares the qualified statements and organization
+// identifier requested in a DER encoded CSR against those in the DER encoded
+// certificate issued for it, and returns any differences.
+func CompareQCStatements(csrDER, certDER []byte) ([]Difference, error) {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csr: %v", err)
+	}
+	cert, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	requested, err := summarize(csr.Extensions, csr.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("csr: %v", err)
+	}
+	issued, err := summarize(cert.Extensions, cert.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("certificate: %v", err)
+	}
+
+	var diffs []Difference
+	compare := func(field, requested, issued string) {
+		if requested != issued {
+			diffs = append(diffs, Difference{Field: field, Requested: requested, Issued: issued})
+		}
+	}
+	compare("QcType", joinOIDs(requested.qcTypes), joinOIDs(issued.qcTypes))
+	compare("CAName", requested.caName, issued.caName)
+	compare("CAID", requested.caID, issued.caID)
+	compare("OrganizationIdentifier", requested.orgID, issued.orgID)
+
+	for _, r := range requested.roles {
+		if !containsRole(issued.roles, r) {
+			diffs = append(diffs, Difference{Field: "Role", Requested: string(r)})
+		}
+	}
+	for _, r := range issued.roles {
+		if !containsRole(requested.roles, r) {
+			diffs = append(diffs, Difference{Field: "Role", Issued: string(r)})
+		}
+	}
+	return diffs, nil
+}
+
+// joinOIDs returns the dotted form of each OID, separated by commas.
+func joinOIDs(oids []asn1.ObjectIdentifier) string {
+	s := make([]string, len(oids))
+	for i, oid := range oids {
+		s[i] = oid.String()
+	}
+	return strings.Join(s, ",")
+}
+
+func containsRole(roles []qcstatements.Role, role qcstatements.Role) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package eidas
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// issueCertificate self-signs a certificate for the CSR, replacing its
+// qcStatements with the given roles.
+func issueCertificate(csrDER []byte, roles []qcstatements.Role) []byte {
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	So(err, ShouldBeNil)
+	ca, err := qcstatements.CompetentAuthorityForCountryCode("GB")
+	So(err, ShouldBeNil)
+	qc, err := qcstatements.Serialize(roles, *ca, qcstatements.QWACType)
+	So(err, ShouldBeNil)
+
+	signer, err := GenerateKey(ECP256)
+	So(err, ShouldBeNil)
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		RawSubject:      csr.RawSubject,
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{qcStatementsExtension(qc, false)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, csr.PublicKey, signer)
+	So(err, ShouldBeNil)
+	return der
+}
+
+func TestCompareQCStatements(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation}
+
+	Convey("matching certificate has no differences", t, func() {
+		csr, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		diffs, err := CompareQCStatements(csr, issueCertificate(csr, roles))
+		So(err, ShouldBeNil)
+		So(diffs, ShouldBeEmpty)
+	})
+
+	Convey("certificate dropping a role", t, func() {
+		csr, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		diffs, err := CompareQCStatements(csr, issueCertificate(csr, roles[:1]))
+		So(err, ShouldBeNil)
+		So(diffs, ShouldResemble, []Difference{{
+			Field:     "Role",
+			Requested: string(qcstatements.RolePaymentInitiation),
+		}})
+	})
+
+	Convey("malformed certificate", t, func() {
+		csr, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		_, err = CompareQCStatements(csr, []byte("not a certificate"))
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,161 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apple/eidas/qcstatements"
+)
+
+// defaultConfigKeySize is the RSA key size used by GenerateFromConfig unless
+// Config.KeySize is set.
+const defaultConfigKeySize = 2048
+
+// Config describes a certificate signing request with plain values, e.g. for
+// declarative pipelines or CSR templates kept in version control. See
+// GenerateFromConfig.
+//
+// Config can be unmarshalled from JSON and, with gopkg.in/yaml.v2 or v3, from
+// YAML. Unmarshalling checks the roles and type and normalizes them to the
+// ETSI role names, e.g. "PSP_AI", and "qwac" or "qseal".
+type Config struct {
+	CountryCode string `json:"country" yaml:"country"`
+	OrgName     string `json:"org" yaml:"org"`
+	OrgID       string `json:"orgId" yaml:"orgId"`
+	CommonName  string `json:"commonName" yaml:"commonName"`
+	// Roles are parsed with qcstatements.RoleFromString, e.g. "AIS" or
+	// "PSP_AI".
+	Roles []string `json:"roles" yaml:"roles"`
+	// Type is "qwac" or "qseal", in any case.
+	Type string `json:"type" yaml:"type"`
+	// KeySize is the size in bits of the generated RSA key. Defaults to 2048.
+	KeySize  int      `json:"keySize,omitempty" yaml:"keySize,omitempty"`
+	DNSNames []string `json:"dnsNames,omitempty" yaml:"dnsNames,omitempty"`
+}
+
+// plainConfig has the fields of Config without its unmarshalling methods.
+type plainConfig Config
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (cfg *Config) UnmarshalJSON(data []byte) error {
+	var p plainConfig
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	return cfg.setNormalized(Config(p))
+}
+
+// UnmarshalYAML implements the Unmarshaler interface of gopkg.in/yaml.v2,
+// which gopkg.in/yaml.v3 also supports.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var p plainConfig
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	return cfg.setNormalized(Config(p))
+}
+
+// setNormalized sets cfg to c with its roles and type normalized.
+func (cfg *Config) setNormalized(c Config) error {
+	if len(c.Roles) != 0 {
+		roles := make([]string, len(c.Roles))
+		for i, name := range c.Roles {
+			r, err := qcstatements.RoleFromString(name)
+			if err != nil {
+				return err
+			}
+			roles[i] = string(r)
+		}
+		c.Roles = roles
+	}
+	if c.Type != "" {
+		if _, err := qcTypeFromString(c.Type); err != nil {
+			return err
+		}
+		c.Type = strings.ToLower(c.Type)
+	}
+	*cfg = c
+	return nil
+}
+
+// GenerateFromConfig validates cfg, generates an RSA key and builds a
+// certificate signing request as described by cfg.
+func GenerateFromConfig(cfg Config, opts ...CertificateOption) ([]byte, crypto.Signer, error) {
+	roles, qcType, err := cfg.parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	keySize := cfg.KeySize
+	if keySize == 0 {
+		keySize = defaultConfigKeySize
+	}
+	if keySize < defaultConfigKeySize {
+		return nil, nil, fmt.Errorf("eidas: key size must be at least %d bits", defaultConfigKeySize)
+	}
+
+	if len(cfg.DNSNames) != 0 {
+		opts = append([]CertificateOption{WithDNSNames(cfg.DNSNames...)}, opts...)
+	}
+	o := newCertificateOptions(opts)
+	key, err := rsa.GenerateKey(o.rand, keySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair: %v", err)
+	}
+	csr, err := GenerateCSRWithKey(cfg.CountryCode, cfg.OrgName, cfg.OrgID, cfg.CommonName, roles, qcType, key, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return csr, key, nil
+}
+
+// parse checks the required fields are set and maps the roles and type to
+// their typed values.
+func (cfg Config) parse() ([]qcstatements.Role, asn1.ObjectIdentifier, error) {
+	for _, f := range []struct {
+		name  string
+		value string
+	}{
+		{"country", cfg.CountryCode},
+		{"org", cfg.OrgName},
+		{"orgId", cfg.OrgID},
+		{"commonName", cfg.CommonName},
+	} {
+		if f.value == "" {
+			return nil, nil, fmt.Errorf("eidas: config is missing %s", f.name)
+		}
+	}
+	if len(cfg.Roles) == 0 {
+		return nil, nil, errors.New("eidas: config is missing roles")
+	}
+
+	roles := make([]qcstatements.Role, len(cfg.Roles))
+	for i, name := range cfg.Roles {
+		r, err := qcstatements.RoleFromString(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		roles[i] = r
+	}
+
+	qcType, err := qcTypeFromString(cfg.Type)
+	if err != nil {
+		return nil, nil, err
+	}
+	return roles, qcType, nil
+}
+
+// qcTypeFromString maps "qwac" or "qseal", in any case, to the QcType.
+func qcTypeFromString(s string) (asn1.ObjectIdentifier, error) {
+	switch strings.ToLower(s) {
+	case "qwac":
+		return qcstatements.QWACType, nil
+	case "qseal":
+		return qcstatements.QSEALType, nil
+	}
+	return nil, fmt.Errorf("eidas: unknown QC type %q: must be qwac or qseal", s)
+}
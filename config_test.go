@@ -0,0 +1,152 @@
+package eidas
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/yaml.v2"
+)
+
+func TestGenerateFromConfig(t *testing.T) {
+	Convey("config from a struct literal", t, func() {
+		data, key, err := GenerateFromConfig(Config{
+			CountryCode: "GB",
+			OrgName:     "Foo Org",
+			OrgID:       "PSDGB-FCA-123456",
+			CommonName:  "Foo Name",
+			Roles:       []string{"AIS", "PIS"},
+			Type:        "qwac",
+			DNSNames:    []string{"example.com"},
+		})
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.CheckSignature(), ShouldBeNil)
+		So(key.(*rsa.PrivateKey).N.BitLen(), ShouldEqual, 2048)
+		So(csr.DNSNames, ShouldResemble, []string{"example.com"})
+
+		info, err := InfoFromCSR(csr)
+		So(err, ShouldBeNil)
+		So(info.Roles, ShouldResemble, []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation})
+		So(info.Type, ShouldResemble, qcstatements.QWACType)
+	})
+
+	Convey("config from JSON", t, func() {
+		var cfg Config
+		err := json.Unmarshal([]byte(`{
+			"country": "GB",
+			"org": "Foo Org",
+			"orgId": "PSDGB-FCA-123456",
+			"commonName": "Foo Name",
+			"roles": ["PSP_AS"],
+			"type": "QSEAL",
+			"keySize": 3072
+		}`), &cfg)
+		So(err, ShouldBeNil)
+		data, key, err := GenerateFromConfig(cfg)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(key.(*rsa.PrivateKey).N.BitLen(), ShouldEqual, 3072)
+		So(csr.Subject.CommonName, ShouldEqual, "Foo Name")
+		info, err := InfoFromCSR(csr)
+		So(err, ShouldBeNil)
+		So(info.Type, ShouldResemble, qcstatements.QSEALType)
+	})
+
+	valid := Config{
+		CountryCode: "GB",
+		OrgName:     "Foo Org",
+		OrgID:       "PSDGB-FCA-123456",
+		CommonName:  "Foo Name",
+		Roles:       []string{"AIS"},
+		Type:        "qseal",
+	}
+	for name, edit := range map[string]func(*Config){
+		"missing country": func(c *Config) { c.CountryCode = "" },
+		"missing roles":   func(c *Config) { c.Roles = nil },
+		"unknown role":    func(c *Config) { c.Roles = []string{"FOO"} },
+		"unknown type":    func(c *Config) { c.Type = "qfoo" },
+		"small key":       func(c *Config) { c.KeySize = 1024 },
+		"invalid SAN":     func(c *Config) { c.DNSNames = []string{"-foo"} },
+	} {
+		Convey(name, t, func() {
+			cfg := valid
+			edit(&cfg)
+			_, _, err := GenerateFromConfig(cfg)
+			So(err, ShouldNotBeNil)
+		})
+	}
+}
+
+func TestConfigUnmarshal(t *testing.T) {
+	Convey("config from YAML", t, func() {
+		var cfg Config
+		So(yaml.Unmarshal([]byte(`
+country: GB
+org: Foo Org
+orgId: PSDGB-FCA-123456
+commonName: Foo Name
+roles:
+  - AIS
+  - pis
+type: QWAC
+dnsNames:
+  - api.example.com
+`), &cfg), ShouldBeNil)
+		So(cfg.Roles, ShouldResemble, []string{"PSP_AI", "PSP_PI"})
+		So(cfg.Type, ShouldEqual, "qwac")
+
+		data, _, err := GenerateFromConfig(cfg)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.CheckSignature(), ShouldBeNil)
+		So(csr.DNSNames, ShouldResemble, []string{"api.example.com"})
+		info, err := InfoFromCSR(csr)
+		So(err, ShouldBeNil)
+		So(info.Roles, ShouldResemble, []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation})
+		So(info.Type, ShouldResemble, qcstatements.QWACType)
+	})
+
+	Convey("QSEAL config from YAML", t, func() {
+		var cfg Config
+		So(yaml.Unmarshal([]byte(`
+country: GB
+org: Foo Org
+orgId: PSDGB-FCA-123456
+commonName: Foo Name
+roles: [PSP_AS]
+type: qseal
+`), &cfg), ShouldBeNil)
+		data, _, err := GenerateFromConfig(cfg)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		info, err := InfoFromCSR(csr)
+		So(err, ShouldBeNil)
+		So(info.Roles, ShouldResemble, []qcstatements.Role{qcstatements.RoleAccountServicing})
+		So(info.Type, ShouldResemble, qcstatements.QSEALType)
+	})
+
+	Convey("YAML with an unknown role", t, func() {
+		var cfg Config
+		So(yaml.Unmarshal([]byte("roles: [FOO]\ntype: qwac\n"), &cfg), ShouldNotBeNil)
+	})
+
+	Convey("JSON roles and type are normalized", t, func() {
+		var cfg Config
+		So(json.Unmarshal([]byte(`{"roles": ["Account Information", "PSP_IC"], "type": "Qseal"}`), &cfg), ShouldBeNil)
+		So(cfg.Roles, ShouldResemble, []string{"PSP_AI", "PSP_IC"})
+		So(cfg.Type, ShouldEqual, "qseal")
+	})
+
+	Convey("JSON with an unknown type", t, func() {
+		var cfg Config
+		So(json.Unmarshal([]byte(`{"type": "qfoo"}`), &cfg), ShouldNotBeNil)
+	})
+}
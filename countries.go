@@ -0,0 +1,54 @@
+package eidas
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCountryCode is returned when a country code is not an officially
+// assigned ISO 3166-1 alpha-2 code, e.g. "GB".
+var ErrInvalidCountryCode = errors.New("eidas: country code must be an ISO 3166-1 alpha-2 code")
+
+// Officially assigned ISO 3166-1 alpha-2 codes.
+var iso3166Alpha2 = func() map[string]bool {
+	codes := strings.Fields(`
+		AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ
+		BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ
+		CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ
+		DE DJ DK DM DO DZ
+		EC EE EG EH ER ES ET
+		FI FJ FK FM FO FR
+		GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY
+		HK HM HN HR HT HU
+		ID IE IL IM IN IO IQ IR IS IT
+		JE JM JO JP
+		KE KG KH KI KM KN KP KR KW KY KZ
+		LA LB LC LI LK LR LS LT LU LV LY
+		MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ
+		NA NC NE NF NG NI NL NO NP NR NU NZ
+		OM
+		PA PE PF PG PH PK PL PM PN PR PS PT PW PY
+		QA
+		RE RO RS RU RW
+		SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ
+		TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ
+		UA UG UM US UY UZ
+		VA VC VE VG VI VN VU
+		WF WS
+		YE YT
+		ZA ZM ZW`)
+	m := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		m[code] = true
+	}
+	return m
+}()
+
+// validateCountryCode checks that code is an ISO 3166-1 alpha-2 code. Whether
+// the country has a known competent authority is checked separately.
+func validateCountryCode(code string) error {
+	if !iso3166Alpha2[code] {
+		return ErrInvalidCountryCode
+	}
+	return nil
+}
@@ -3,44 +3,867 @@
 package eidas
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha1"
+	_ "crypto/sha1" // Registers crypto.SHA1 for subject key identifiers.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
-	"encoding/binary"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/apple/eidas/internal/pkcs10"
 	"github.com/apple/eidas/qcstatements"
 )
 
-type CertificateOption func(*x509.CertificateRequest)
+// ErrOBNamingPolicy is returned when WithOBNamingPolicy is set and the common
+// name doesn't equal the organization identifier.
+var ErrOBNamingPolicy = errors.New("eidas: common name must equal organization identifier under the Open Banking naming policy")
+
+// ErrOrgIDAuthorityMismatch is returned when a PSD2 organization identifier,
+// e.g. "PSDGB-FCA-123456", names a different competent authority than the one
+// resolved from the country code.
+var ErrOrgIDAuthorityMismatch = errors.New("eidas: organization identifier does not match competent authority")
+
+// ErrNoOrganizationIdentifier is returned when a subject set with
+// WithRawSubject has no organizationIdentifier attribute.
+var ErrNoOrganizationIdentifier = errors.New("eidas: subject must have an organizationIdentifier")
+
+// ErrCommonNameTooLong is returned when the common name exceeds the 64
+// character upper bound of RFC 5280 Appendix A.1, unless
+// WithCommonNameTruncation is set.
+var ErrCommonNameTooLong = errors.New("eidas: common name must not exceed 64 characters")
+
+// ErrMissingDNSName is returned when a QWAC has no DNS name Subject Alternate
+// Name, unless WithSANValidation(false) is set.
+var ErrMissingDNSName = errors.New("eidas: QWAC must have at least one DNS name")
+
+// ErrUnexpectedSAN is returned when a QSEAL has a Subject Alternate Name,
+// unless WithSANValidation(false) is set.
+var ErrUnexpectedSAN = errors.New("eidas: QSEAL must not have a subject alternate name")
+
+// ErrNilSigner is returned when the private key passed to a generator is nil.
+var ErrNilSigner = errors.New("eidas: signer must not be nil")
+
+// ErrWeakKey is returned when the signer's key falls short of the eIDAS
+// minimum strength checked by MeetsEIDASKeyStrength.
+var ErrWeakKey = errors.New("eidas: key does not meet the eIDAS minimum strength")
+
+// ErrExtensionsDropped is returned when WithExtensionRequestAttribute(false)
+// would drop the requested extensions, such as qcStatements, from a CSR.
+var ErrExtensionsDropped = errors.New("eidas: extensionRequest attribute cannot be omitted when extensions are requested")
+
+// maxCommonNameLength is ub-common-name from RFC 5280 Appendix A.1.
+const maxCommonNameLength = 64
+
+// CertificateOption configures optional aspects of CSR generation.
+type CertificateOption func(*certificateOptions)
+
+type certificateOptions struct {
+	rand      io.Reader
+	dnsNames  []string
+	dirNames  []pkix.Name
+	qcOptions []qcstatements.SerializeOption
+	caName    string
+	caLang    string
+	qcTypes   []asn1.ObjectIdentifier
+	ca        *qcstatements.CompetentAuthority
+
+	qcStatementsCritical bool
+	keyUsageCritical     bool
+
+	attributes       []asn1.RawValue
+	extensionRequest *bool
+	err              error
+
+	signatureAlgorithm x509.SignatureAlgorithm
+	skiHash            crypto.Hash
+	ski                bool
+	rawPublicKey       []byte
+	extensionOrder     []asn1.ObjectIdentifier
+	version            int
+
+	serverAuth   bool
+	clientAuth   bool
+	extKeyUsages []asn1.ObjectIdentifier
+
+	obNamingPolicy bool
+	sanValidation  bool
+
+	// extensions are further extensions added after qcStatements.
+	extensions []pkix.Extension
+
+	notBefore  time.Time
+	notAfter   time.Time
+	certSerial *big.Int
+	aki        bool
+
+	// basicConstraints is set by WithBasicConstraints.
+	basicConstraints bool
+	isCA             bool
+	maxPathLen       int
+
+	permittedDNSDomains []string
+	excludedDNSDomains  []string
+
+	// rawSubject and commonName override the subject and common name passed
+	// to the generator.
+	rawSubject          *pkix.Name
+	commonName          string
+	truncateCommonName  bool
+	subjectType         SubjectType
+	givenName           string
+	surname             string
+	additionalOrgNames  []string
+	additionalCountries []string
+	serialNumber        string
+	businessCategory    string
+	jurisdiction        string
+	orgIDStringTag      int
+	commonNameStringTag int
+	legacyOrgIDLocation bool
+}
+
+func newCertificateOptions(opts []CertificateOption) *certificateOptions {
+	o := &certificateOptions{
+		rand:             rand.Reader,
+		skiHash:          crypto.SHA1,
+		ski:              true,
+		keyUsageCritical: true,
+		serverAuth:       true,
+		clientAuth:       true,
+		sanValidation:    true,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
 
 // WithDNSName adds the given domain as a Subject Alternate Name to the CSR.
 func WithDNSName(domain string) CertificateOption {
-	return func(req *x509.CertificateRequest) {
-		req.DNSNames = append(req.DNSNames, domain)
+	return func(o *certificateOptions) {
+		o.dnsNames = append(o.dnsNames, domain)
+	}
+}
+
+// WithDNSNames adds each of the given domains as a Subject Alternate Name to
+// the CSR, in order. Each domain must be a valid hostname.
+func WithDNSNames(domains ...string) CertificateOption {
+	return func(o *certificateOptions) {
+		for _, domain := range domains {
+			if err := validateHostname(domain); err != nil {
+				o.err = err
+				return
+			}
+		}
+		o.dnsNames = append(o.dnsNames, domains...)
+	}
+}
+
+// validateHostname performs a basic syntax check of a DNS hostname as
+// described in RFC 1123 Section 2.1.
+func validateHostname(name string) error {
+	if len(name) == 0 || len(name) > 253 {
+		return fmt.Errorf("invalid hostname %q: must be between 1 and 253 characters", name)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("invalid hostname %q: labels must be between 1 and 63 characters", name)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid hostname %q: labels must not start or end with a hyphen", name)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid hostname %q: invalid character %q", name, c)
+			}
+		}
+	}
+	return nil
+}
+
+// WithWildcardDNSName sets the common name to the given wildcard domain, e.g.
+// "*.api.example.com", and adds it as a Subject Alternate Name to the CSR,
+// overriding the common name passed to the generator. The wildcard must be
+// the whole leftmost label.
+func WithWildcardDNSName(domain string) CertificateOption {
+	return func(o *certificateOptions) {
+		if !strings.HasPrefix(domain, "*.") {
+			o.err = fmt.Errorf("invalid wildcard hostname %q: must start with \"*.\"", domain)
+			return
+		}
+		if err := validateHostname(strings.TrimPrefix(domain, "*.")); err != nil {
+			o.err = fmt.Errorf("invalid wildcard hostname %q: %v", domain, err)
+			return
+		}
+		o.commonName = domain
+		o.dnsNames = append(o.dnsNames, domain)
+	}
+}
+
+// WithDirectoryNameSAN adds the given name as a directoryName Subject
+// Alternate Name to the CSR, alongside any DNS names.
+func WithDirectoryNameSAN(name pkix.Name) CertificateOption {
+	return func(o *certificateOptions) {
+		o.dirNames = append(o.dirNames, name)
+	}
+}
+
+// WithRandSource sets the source of randomness used for key generation and
+// signing. Defaults to crypto/rand.Reader.
+//
+// With a fixed key and a deterministic reader the output is reproducible
+// byte for byte if the signature scheme is deterministic, i.e. RSA PKCS#1
+// v1.5 or Ed25519. ECDSA and RSASSA-PSS signatures are randomized, so only the
+// CertificationRequestInfo is reproducible with those. Newly generated keys
+// may not be reproducible, as crypto/rsa and crypto/ecdsa can ignore the
+// reader. Self-signed certificates additionally take their serial number
+// from the reader and are only reproducible with WithValidity.
+func WithRandSource(r io.Reader) CertificateOption {
+	return func(o *certificateOptions) {
+		o.rand = r
+	}
+}
+
+// WithQCCompliance adds a QcCompliance statement to the qualified statements,
+// claiming the certificate is an EU qualified certificate.
+func WithQCCompliance() CertificateOption {
+	return func(o *certificateOptions) {
+		o.qcOptions = append(o.qcOptions, qcstatements.WithCompliance())
+	}
+}
+
+// WithTransactionLimit adds a QcLimitValue statement to the qualified
+// statements, limiting the value of transactions the certificate may be used for.
+func WithTransactionLimit(limit qcstatements.MonetaryLimit) CertificateOption {
+	return func(o *certificateOptions) {
+		o.qcOptions = append(o.qcOptions, qcstatements.WithLimitValue(limit))
+	}
+}
+
+// WithPDSLocation adds the location of a PKI disclosure statement, with the
+// two-letter ISO 639-1 code of its language, to a QcPDS statement.
+func WithPDSLocation(url string, language string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.qcOptions = append(o.qcOptions, qcstatements.WithPDSLocations(qcstatements.PDSLocation{URL: url, Language: language}))
+	}
+}
+
+// WithCustomQCStatement appends an arbitrary statement, e.g. one defined by a
+// national scheme, to the qualified statements. value is the DER encoded
+// statementInfo, or nil if the statement has none.
+func WithCustomQCStatement(id asn1.ObjectIdentifier, value []byte) CertificateOption {
+	return func(o *certificateOptions) {
+		o.qcOptions = append(o.qcOptions, qcstatements.WithStatement(id, value))
+	}
+}
+
+// WithAdditionalQCType lists the given type, e.g. qcstatements.QESIGNType, in
+// the QcType statement after the type passed to the generator. The key usage
+// and extended key usage are still derived from the generator's type.
+func WithAdditionalQCType(t asn1.ObjectIdentifier) CertificateOption {
+	return func(o *certificateOptions) {
+		o.qcTypes = append(o.qcTypes, t)
+	}
+}
+
+// WithCompetentAuthorityName overrides the name of the competent authority in
+// the PSD2 statement, e.g. to match the NCA register's name in the national
+// language. The NCA identifier is still derived from the country code.
+func WithCompetentAuthorityName(name string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.caName = name
+	}
+}
+
+// WithCompetentAuthorityLanguage selects the name of the competent authority
+// in the given ISO 639-1 language, e.g. "de", for the PSD2 statement. The
+// default name is used if no name in that language is known.
+func WithCompetentAuthorityLanguage(lang string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.caLang = lang
+	}
+}
+
+// WithCompetentAuthority overrides the competent authority otherwise resolved
+// from the country code, e.g. for an authority not in the ETSI register. The
+// organization identifier is not checked against an overridden authority.
+func WithCompetentAuthority(ca qcstatements.CompetentAuthority) CertificateOption {
+	return func(o *certificateOptions) {
+		o.ca = &ca
+	}
+}
+
+// WithQCStatementsCritical sets whether the qcStatements extension is marked
+// as critical. Defaults to false.
+func WithQCStatementsCritical(critical bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.qcStatementsCritical = critical
+	}
+}
+
+// WithKeyUsageCritical sets whether the keyUsage extension is marked as
+// critical. Defaults to true, as recommended by RFC 5280 Section 4.2.1.3.
+func WithKeyUsageCritical(critical bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.keyUsageCritical = critical
+	}
+}
+
+// WithChallengePassword adds a PKCS#9 challengePassword attribute to the CSR.
+func WithChallengePassword(password string) CertificateOption {
+	return func(o *certificateOptions) {
+		attr, err := pkcs10.ChallengePasswordAttribute(password)
+		if err != nil {
+			o.err = fmt.Errorf("failed to encode challenge password: %v", err)
+			return
+		}
+		o.attributes = append(o.attributes, attr)
+	}
+}
+
+// WithExtensionRequestAttribute controls the presence of the PKCS#9
+// extensionRequest attribute, which carries the requested extensions. When
+// true the attribute is included even if no extensions are requested; false
+// is only allowed when there are none, as otherwise the qcStatements and
+// other requested extensions would be dropped, and CSR generation fails with
+// ErrExtensionsDropped. By default it is included only if there are
+// extensions to request.
+func WithExtensionRequestAttribute(present bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.extensionRequest = &present
+	}
+}
+
+// WithCSRVersion sets the version field of the CSR, e.g. to test validators.
+// Defaults to 0, the only version defined by RFC 2986. It has no effect on
+// self-signed certificates.
+func WithCSRVersion(version int) CertificateOption {
+	return func(o *certificateOptions) {
+		if version < 0 {
+			o.err = errors.New("eidas: CSR version must not be negative")
+			return
+		}
+		o.version = version
+	}
+}
+
+// WithExtensionOrder sets the order of the requested extensions, e.g. for CAs
+// sensitive to it. Every extension in the CSR must be listed; listed
+// extensions which aren't in the CSR are ignored. By default the order is
+// subjectAltName, keyUsage, extKeyUsage, subjectKeyIdentifier, qcStatements.
+func WithExtensionOrder(order []asn1.ObjectIdentifier) CertificateOption {
+	return func(o *certificateOptions) {
+		o.extensionOrder = append([]asn1.ObjectIdentifier(nil), order...)
+	}
+}
+
+// orderExtensions sorts exts into the given order. It returns an error if an
+// extension isn't listed in order.
+func orderExtensions(exts []pkix.Extension, order []asn1.ObjectIdentifier) ([]pkix.Extension, error) {
+	for _, ext := range exts {
+		found := false
+		for _, id := range order {
+			if ext.Id.Equal(id) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("eidas: extension %v missing from extension order", ext.Id)
+		}
+	}
+	ordered := make([]pkix.Extension, 0, len(exts))
+	used := make([]bool, len(exts))
+	for _, id := range order {
+		for i, ext := range exts {
+			if !used[i] && ext.Id.Equal(id) {
+				ordered = append(ordered, ext)
+				used[i] = true
+			}
+		}
+	}
+	return ordered, nil
+}
+
+// WithSignatureAlgorithm sets the algorithm used to sign the CSR, e.g.
+// x509.SHA256WithRSAPSS. RSA keys support SHA-256, SHA-384 and SHA-512 with
+// either PKCS#1 v1.5 or PSS, and ECDSA keys support SHA-256, SHA-384 and
+// SHA-512. Defaults to x509.SHA256WithRSA for RSA keys, x509.ECDSAWithSHA256
+// for ECDSA keys and x509.PureEd25519 for Ed25519 keys.
+func WithSignatureAlgorithm(alg x509.SignatureAlgorithm) CertificateOption {
+	return func(o *certificateOptions) {
+		o.signatureAlgorithm = alg
+	}
+}
+
+// WithSubjectKeyIdentifierHash sets the hash used to compute the subject key
+// identifier. Defaults to crypto.SHA1. crypto.SHA256, crypto.SHA384 and
+// crypto.SHA512 are truncated to 160 bits as described in RFC 7093 Section 2.
+func WithSubjectKeyIdentifierHash(hash crypto.Hash) CertificateOption {
+	return func(o *certificateOptions) {
+		switch hash {
+		case crypto.SHA1, crypto.SHA256, crypto.SHA384, crypto.SHA512:
+			o.skiHash = hash
+		default:
+			o.err = fmt.Errorf("unsupported subject key identifier hash: %v", hash)
+		}
+	}
+}
+
+// WithSubjectKeyIdentifier sets whether the subjectKeyIdentifier extension is
+// included, e.g. for CAs which reject one supplied by the client. Defaults to
+// true.
+func WithSubjectKeyIdentifier(enabled bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.ski = enabled
+	}
+}
+
+// WithRawSubjectPublicKeyInfo uses the given DER encoded SubjectPublicKeyInfo
+// verbatim in the CSR, e.g. to match exactly what an HSM exports. It must be an
+// RSA, ECDSA or Ed25519 key and must be the public key of the signer. It has no
+// effect on self-signed certificates.
+func WithRawSubjectPublicKeyInfo(spki []byte) CertificateOption {
+	return func(o *certificateOptions) {
+		pub, err := x509.ParsePKIXPublicKey(spki)
+		if err != nil {
+			o.err = fmt.Errorf("eidas: invalid subject public key info: %v", err)
+			return
+		}
+		if _, err := publicKeyAlgorithm(pub); err != nil {
+			o.err = err
+			return
+		}
+		o.rawPublicKey = append([]byte(nil), spki...)
+	}
+}
+
+// WithServerAuth sets whether a QWAC includes the TLS server authentication
+// extended key usage. Defaults to true.
+func WithServerAuth(enabled bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.serverAuth = enabled
+	}
+}
+
+// WithClientAuth sets whether a QWAC includes the TLS client authentication
+// extended key usage. Defaults to true.
+func WithClientAuth(enabled bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.clientAuth = enabled
+	}
+}
+
+// WithExtendedKeyUsage adds the given extended key usages, e.g.
+// emailProtection (1.3.6.1.5.5.7.3.4), after the defaults for the QcType:
+// TLS server and client authentication for a QWAC and none for a QSEAL.
+func WithExtendedKeyUsage(usages []asn1.ObjectIdentifier) CertificateOption {
+	return func(o *certificateOptions) {
+		o.extKeyUsages = append(o.extKeyUsages, usages...)
+	}
+}
+
+// WithOBNamingPolicy enforces the Open Banking naming policy, which requires the
+// common name to equal the organization identifier.
+func WithOBNamingPolicy() CertificateOption {
+	return func(o *certificateOptions) {
+		o.obNamingPolicy = true
+	}
+}
+
+// WithOBSoftwareStatementID adds a non-critical extension with the given Open
+// Banking directory software statement ID, encoded as a UTF8String, under
+// extID. There is no registered extension ID, so extID must be the one agreed
+// with the CA.
+func WithOBSoftwareStatementID(extID asn1.ObjectIdentifier, id string) CertificateOption {
+	return func(o *certificateOptions) {
+		if len(extID) == 0 {
+			o.err = errors.New("eidas: software statement ID extension ID must be set")
+			return
+		}
+		if id == "" || !utf8.ValidString(id) {
+			o.err = fmt.Errorf("eidas: invalid software statement ID %q", id)
+			return
+		}
+		d, err := asn1.MarshalWithParams(id, "utf8")
+		if err != nil {
+			o.err = fmt.Errorf("failed to encode software statement ID: %v", err)
+			return
+		}
+		o.extensions = append(o.extensions, pkix.Extension{
+			Id:    append(asn1.ObjectIdentifier(nil), extID...),
+			Value: d,
+		})
+	}
+}
+
+// WithRequestedValidity adds a non-critical extension under extID asking the
+// CA for a certificate valid until notAfter, encoded as a GeneralizedTime in
+// UTC with second precision. There is no registered extension ID, so extID
+// must be the one agreed with the CA. It is only a hint: CAs may ignore it and
+// choose their own validity period.
+func WithRequestedValidity(extID asn1.ObjectIdentifier, notAfter time.Time) CertificateOption {
+	return func(o *certificateOptions) {
+		if len(extID) == 0 {
+			o.err = errors.New("eidas: requested validity extension ID must be set")
+			return
+		}
+		if notAfter.IsZero() {
+			o.err = errors.New("eidas: requested notAfter must be set")
+			return
+		}
+		d, err := asn1.MarshalWithParams(notAfter.UTC().Truncate(time.Second), "generalized")
+		if err != nil {
+			o.err = fmt.Errorf("failed to encode requested validity: %v", err)
+			return
+		}
+		o.extensions = append(o.extensions, pkix.Extension{
+			Id:    append(asn1.ObjectIdentifier(nil), extID...),
+			Value: d,
+		})
+	}
+}
+
+// WithSANValidation sets whether the Subject Alternate Names are checked
+// against the Open Banking profiles, which require a QWAC to have at least one
+// DNS name and a QSEAL to have none. Defaults to true.
+func WithSANValidation(enabled bool) CertificateOption {
+	return func(o *certificateOptions) {
+		o.sanValidation = enabled
+	}
+}
+
+// withoutSubjectAltNames removes any Subject Alternate Names added by earlier
+// options.
+func withoutSubjectAltNames() CertificateOption {
+	return func(o *certificateOptions) {
+		o.dnsNames = nil
+		o.dirNames = nil
+	}
+}
+
+// WithRawSubject uses the given subject as is, overriding the country code,
+// organization name, organization identifier and common name passed to the
+// generator, which are only used to resolve the competent authority. For PSD2
+// compliance the subject must include an organizationIdentifier attribute
+// (2.5.4.97) in ExtraNames or Names.
+func WithRawSubject(subject pkix.Name) CertificateOption {
+	return func(o *certificateOptions) {
+		o.rawSubject = &subject
+	}
+}
+
+// WithAdditionalCountry adds a further countryName attribute with the given
+// ISO-3166-1 alpha-2 code to the subject after the primary one, e.g. for an
+// organization registered in several countries.
+func WithAdditionalCountry(countryCode string) CertificateOption {
+	return func(o *certificateOptions) {
+		if err := validateCountryCode(countryCode); err != nil {
+			o.err = err
+			return
+		}
+		o.additionalCountries = append(o.additionalCountries, countryCode)
+	}
+}
+
+// WithAdditionalOrganizationName adds a further organizationName attribute to
+// the subject after the primary one, e.g. for a trading name.
+func WithAdditionalOrganizationName(name string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.additionalOrgNames = append(o.additionalOrgNames, name)
+	}
+}
+
+// WithSubjectSerialNumber adds a serialNumber attribute to the subject.
+func WithSubjectSerialNumber(sn string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.serialNumber = sn
+	}
+}
+
+// WithLegacyOrgIDLocation puts the organization identifier in a serialNumber
+// (2.5.4.5) subject attribute instead of organizationIdentifier (2.5.4.97), as
+// required by some older NCA profiles. It can't be combined with
+// WithSubjectSerialNumber.
+func WithLegacyOrgIDLocation() CertificateOption {
+	return func(o *certificateOptions) {
+		o.legacyOrgIDLocation = true
+	}
+}
+
+// WithBusinessCategory adds a businessCategory attribute to the subject, e.g.
+// "Private Organization" for EV certificates.
+func WithBusinessCategory(category string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.businessCategory = category
+	}
+}
+
+// WithJurisdictionCountry adds a jurisdictionOfIncorporationCountryName
+// attribute with the given ISO-3166-1 alpha-2 code to the subject.
+func WithJurisdictionCountry(countryCode string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.jurisdiction = countryCode
+	}
+}
+
+// WithOrgIDStringType forces the ASN.1 string type of the
+// organizationIdentifier attribute to asn1.TagPrintableString or
+// asn1.TagUTF8String. By default PrintableString is used if the identifier
+// allows it and UTF8String otherwise.
+func WithOrgIDStringType(tag int) CertificateOption {
+	return func(o *certificateOptions) {
+		switch tag {
+		case asn1.TagPrintableString, asn1.TagUTF8String:
+			o.orgIDStringTag = tag
+		default:
+			o.err = fmt.Errorf("eidas: unsupported organization identifier string type: %d", tag)
+		}
+	}
+}
+
+// WithCommonNameStringType forces the ASN.1 string type of the commonName
+// attribute to asn1.TagPrintableString or asn1.TagUTF8String. By default
+// PrintableString is used if the name allows it and UTF8String otherwise.
+func WithCommonNameStringType(tag int) CertificateOption {
+	return func(o *certificateOptions) {
+		switch tag {
+		case asn1.TagPrintableString, asn1.TagUTF8String:
+			o.commonNameStringTag = tag
+		default:
+			o.err = fmt.Errorf("eidas: unsupported common name string type: %d", tag)
+		}
+	}
+}
+
+// WithCommonNameTruncation truncates a common name longer than 64 characters
+// instead of returning ErrCommonNameTooLong.
+func WithCommonNameTruncation() CertificateOption {
+	return func(o *certificateOptions) {
+		o.truncateCommonName = true
+	}
+}
+
+// SubjectType distinguishes certificates for legal persons from those for
+// natural persons. See ETSI EN 319 412-2 and ETSI EN 319 412-3.
+type SubjectType int
+
+// Supported subject types.
+const (
+	// LegalPerson subjects carry an organizationName. This is the default.
+	LegalPerson SubjectType = iota
+	// NaturalPerson subjects carry a givenName and surname instead of an
+	// organizationName. Qualified seals can only be issued to legal persons.
+	NaturalPerson
+)
+
+// WithSubjectType sets whether the subject is a legal or natural person.
+// Defaults to LegalPerson.
+func WithSubjectType(t SubjectType) CertificateOption {
+	return func(o *certificateOptions) {
+		o.subjectType = t
+	}
+}
+
+// WithGivenName adds a givenName attribute to the subject of a NaturalPerson.
+func WithGivenName(name string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.givenName = name
+	}
+}
+
+// WithSurname adds a surname attribute to the subject of a NaturalPerson.
+func WithSurname(name string) CertificateOption {
+	return func(o *certificateOptions) {
+		o.surname = name
 	}
 }
 
 // GenerateCSRWithKey builds a certificate signing request for an organization based on an existing private key.
 // qcType should be one of qcstatements.QSEALType or qcstatements.QWACType.
+//
+// priv may be any crypto.Signer, e.g. one backed by a PKCS#11 token. Its Sign
+// method is passed the digest along with options derived from the signature
+// algorithm: the crypto.Hash for PKCS#1 v1.5 and ECDSA, an *rsa.PSSOptions
+// with rsa.PSSSaltLengthEqualsHash for RSASSA-PSS, and crypto.Hash(0) with
+// the unhashed message for Ed25519.
 func GenerateCSRWithKey(
 	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, opts ...CertificateOption) ([]byte, error) {
-	if _, ok := priv.Public().(*rsa.PublicKey); !ok {
-		return nil, fmt.Errorf("only RSA keys are currently supported but got: %T", priv.Public())
+	return GenerateCSRWithKeyContext(context.Background(), countryCode, orgName, orgID, commonName, roles, qcType, priv, opts...)
+}
+
+// GenerateCSRWithKeyContext is like GenerateCSRWithKey but returns ctx.Err()
+// if ctx is done before or after signing, e.g. with a slow HSM-backed signer.
+// The signing call itself is not interrupted.
+func GenerateCSRWithKeyContext(ctx context.Context,
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, opts ...CertificateOption) ([]byte, error) {
+	o := newCertificateOptions(opts)
+	req, err := buildRequest(countryCode, orgName, orgID, commonName, roles, qcType, priv, o)
+	if err != nil {
+		return nil, err
+	}
+	if o.rawPublicKey != nil {
+		// The option has already checked that it parses.
+		pub, _ := x509.ParsePKIXPublicKey(o.rawPublicKey)
+		if k, ok := pub.(interface{ Equal(crypto.PublicKey) bool }); !ok || !k.Equal(priv.Public()) {
+			return nil, errors.New("eidas: subject public key info does not match the signer's public key")
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	ca, err := qcstatements.CompetentAuthorityForCountryCode(countryCode)
+	tbs, err := buildTBSCertificateRequest(req, priv, o)
+	if err == ErrExtensionsDropped {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to generate csr: %v", err)
+	}
+	csr, err := pkcs10.Sign(o.rand, *tbs, req.SignatureAlgorithm, priv)
 	if err != nil {
-		return nil, fmt.Errorf("eidas: %v", err)
+		return nil, fmt.Errorf("failed to generate csr: %v", err)
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
 
-	qc, err := qcstatements.Serialize(roles, *ca, qcType)
+// buildTBSCertificateRequest assembles the CertificationRequestInfo for req
+// the way crypto/x509 does, with the SAN extension built from req.DNSNames
+// first, plus the attributes, public key encoding and version set by options.
+func buildTBSCertificateRequest(req *x509.CertificateRequest, priv crypto.Signer, o *certificateOptions) (*pkcs10.TBSCertificateRequest, error) {
+	spki := o.rawPublicKey
+	if spki == nil {
+		var err error
+		spki, err = x509.MarshalPKIXPublicKey(priv.Public())
+		if err != nil {
+			return nil, err
+		}
+	}
+	extensions := req.ExtraExtensions
+	if len(req.DNSNames) != 0 {
+		san, err := subjectAltNameExtension(req.DNSNames, nil)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append([]pkix.Extension{san}, extensions...)
+	}
+
+	var attrs []asn1.RawValue
+	includeExtensions := len(extensions) != 0
+	if o.extensionRequest != nil {
+		if !*o.extensionRequest && includeExtensions {
+			return nil, ErrExtensionsDropped
+		}
+		includeExtensions = *o.extensionRequest
+	}
+	if includeExtensions {
+		attr, err := pkcs10.ExtensionRequestAttribute(extensions)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, attr)
+	}
+	attrs = append(attrs, o.attributes...)
+
+	return &pkcs10.TBSCertificateRequest{
+		Version:       o.version,
+		Subject:       asn1.RawValue{FullBytes: req.RawSubject},
+		PublicKey:     asn1.RawValue{FullBytes: spki},
+		RawAttributes: attrs,
+	}, nil
+}
+
+// buildRequest validates the options and assembles the subject and extensions
+// shared by CSRs and self-signed certificates.
+func buildRequest(
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, o *certificateOptions) (*x509.CertificateRequest, error) {
+	if priv == nil {
+		return nil, ErrNilSigner
+	}
+	pubKeyAlgo, err := publicKeyAlgorithm(priv.Public())
 	if err != nil {
-		return nil, fmt.Errorf("eidas: %v", err)
+		return nil, err
+	}
+	if ok, _ := MeetsEIDASKeyStrength(priv.Public()); !ok {
+		return nil, ErrWeakKey
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	if err := validateQCType(qcType); err != nil {
+		return nil, err
+	}
+	if err := validateCountryCode(countryCode); err != nil {
+		return nil, err
+	}
+	if o.rawSubject != nil {
+		orgID = nameAttribute(o.rawSubject, oidOrganizationID)
+		if orgID == "" {
+			return nil, ErrNoOrganizationIdentifier
+		}
+		commonName = o.rawSubject.CommonName
+		if commonName == "" {
+			commonName = nameAttribute(o.rawSubject, oidCommonName)
+		}
+	}
+	if o.commonName != "" {
+		commonName = o.commonName
+	}
+	switch o.subjectType {
+	case LegalPerson:
+		if o.givenName != "" || o.surname != "" {
+			return nil, errors.New("eidas: givenName and surname require a NaturalPerson subject")
+		}
+	case NaturalPerson:
+		if qcType.Equal(qcstatements.QSEALType) {
+			return nil, errors.New("eidas: QSEAL certificates can only be issued to legal persons")
+		}
+	default:
+		return nil, fmt.Errorf("eidas: unknown subject type: %d", o.subjectType)
+	}
+	if o.obNamingPolicy && commonName != orgID {
+		return nil, ErrOBNamingPolicy
+	}
+	if o.sanValidation {
+		switch {
+		case qcType.Equal(qcstatements.QWACType) && len(o.dnsNames) == 0:
+			return nil, ErrMissingDNSName
+		case qcType.Equal(qcstatements.QSEALType) && (len(o.dnsNames) != 0 || len(o.dirNames) != 0):
+			return nil, ErrUnexpectedSAN
+		}
+	}
+	if o.signatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		o.signatureAlgorithm = defaultSignatureAlgorithm(pubKeyAlgo)
+	}
+	if err := pkcs10.CheckSignatureAlgorithm(o.signatureAlgorithm, pubKeyAlgo); err != nil {
+		return nil, err
+	}
+
+	if o.ca == nil {
+		ca, err := competentAuthority(countryCode, o)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOrgIDAuthority(orgID, ca); err != nil {
+			return nil, err
+		}
+	}
+
+	qc, err := serializeQCStatements(countryCode, roles, qcType, o)
+	if err != nil {
+		return nil, err
 	}
 
 	keyUsage, err := keyUsageForType(qcType)
@@ -51,41 +874,63 @@ func GenerateCSRWithKey(
 	if err != nil {
 		return nil, err
 	}
+	extendedKeyUsage = filterExtendedKeyUsage(extendedKeyUsage, o)
 
-	extensions := []pkix.Extension{
-		keyUsageExtension(keyUsage),
-	}
+	keyUsageExt := keyUsageExtension(keyUsage)
+	keyUsageExt.Critical = o.keyUsageCritical
+	extensions := []pkix.Extension{keyUsageExt}
 	if len(extendedKeyUsage) != 0 {
 		extensions = append(extensions, extendedKeyUsageExtension(extendedKeyUsage))
 	}
-	extensions = append(extensions, subjectKeyIdentifier(priv.Public().(*rsa.PublicKey)), qcStatementsExtension(qc))
-
-	subject, err := buildSubject(countryCode, orgName, commonName, orgID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build CSR subject: %v", err)
+	if o.ski {
+		ski, err := subjectKeyIdentifier(priv.Public(), o.skiHash)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, ski)
 	}
-	req := &x509.CertificateRequest{
-		Version:            0,
-		RawSubject:         subject,
-		SignatureAlgorithm: x509.SHA256WithRSA,
-		PublicKeyAlgorithm: x509.RSA,
-		ExtraExtensions:    extensions,
+	extensions = append(extensions, qcStatementsExtension(qc, o.qcStatementsCritical))
+	extensions = append(extensions, o.extensions...)
+
+	// crypto/x509 can't encode directory names, so the whole SAN extension is
+	// built here in that case. It is also built here when the extensions are
+	// reordered, as crypto/x509 always puts its own SAN extension first.
+	dnsNames := o.dnsNames
+	if len(o.dirNames) != 0 || (o.extensionOrder != nil && len(o.dnsNames) != 0) {
+		san, err := subjectAltNameExtension(o.dnsNames, o.dirNames)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, san)
+		dnsNames = nil
 	}
-	for _, opt := range opts {
-		opt(req)
+	if o.extensionOrder != nil {
+		extensions, err = orderExtensions(extensions, o.extensionOrder)
+		if err != nil {
+			return nil, err
+		}
 	}
-	csr, err := x509.CreateCertificateRequest(rand.Reader, req, priv)
+
+	subject, err := buildSubject(countryCode, orgName, commonName, orgID, o)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate csr: %v", err)
+		return nil, fmt.Errorf("failed to build CSR subject: %w", err)
 	}
-	return csr, err
+	return &x509.CertificateRequest{
+		Version:            o.version,
+		RawSubject:         subject,
+		SignatureAlgorithm: o.signatureAlgorithm,
+		PublicKeyAlgorithm: pubKeyAlgo,
+		ExtraExtensions:    extensions,
+		DNSNames:           dnsNames,
+	}, nil
 }
 
 // GenerateCSR generates an RSA key and builds a certificate signing request for an organization.
 // qcType should be one of qcstatements.QSEALType or qcstatements.QWACType.
 func GenerateCSR(
 	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, opts ...CertificateOption) ([]byte, *rsa.PrivateKey, error) {
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	o := newCertificateOptions(opts)
+	key, err := rsa.GenerateKey(o.rand, 2048)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to generate key pair: %v", err)
 	}
@@ -97,6 +942,80 @@ func GenerateCSR(
 	return csr, key, nil
 }
 
+// GenerateCSRWithAlgorithm generates a key of the given algorithm and builds a
+// certificate signing request for an organization.
+// qcType should be one of qcstatements.QSEALType or qcstatements.QWACType.
+func GenerateCSRWithAlgorithm(
+	algo KeyAlgorithm, countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, opts ...CertificateOption) ([]byte, crypto.Signer, error) {
+	o := newCertificateOptions(opts)
+	key, err := generateKey(algo, o.rand)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key pair: %v", err)
+	}
+
+	csr, err := GenerateCSRWithKey(countryCode, orgName, orgID, commonName, roles, qcType, key, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return csr, key, nil
+}
+
+// OBPair holds the CSRs and keys for an Open Banking QWAC (OBWAC) and QSEAL
+// (OBSEAL) sharing the same subject.
+type OBPair struct {
+	QWAC     []byte
+	QWACKey  *rsa.PrivateKey
+	QSEAL    []byte
+	QSEALKey *rsa.PrivateKey
+}
+
+// GenerateOBPair generates a QWAC and a QSEAL certificate signing request,
+// each with its own RSA key, for the same organization. Subject Alternate
+// Names are only added to the QWAC.
+func GenerateOBPair(
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, opts ...CertificateOption) (*OBPair, error) {
+	qwac, qwacKey, err := GenerateCSR(countryCode, orgName, orgID, commonName, roles, qcstatements.QWACType, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QWAC csr: %v", err)
+	}
+	qsealOpts := append(append([]CertificateOption(nil), opts...), withoutSubjectAltNames())
+	qseal, qsealKey, err := GenerateCSR(countryCode, orgName, orgID, commonName, roles, qcstatements.QSEALType, qsealOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QSEAL csr: %v", err)
+	}
+	return &OBPair{
+		QWAC:     qwac,
+		QWACKey:  qwacKey,
+		QSEAL:    qseal,
+		QSEALKey: qsealKey,
+	}, nil
+}
+
+// GenerateCSRPerRole builds a separate certificate signing request for each of
+// the given roles, all sharing the same private key.
+// qcType should be one of qcstatements.QSEALType or qcstatements.QWACType.
+func GenerateCSRPerRole(
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, opts ...CertificateOption) (map[qcstatements.Role][]byte, error) {
+	csrs := make(map[qcstatements.Role][]byte, len(roles))
+	for _, role := range roles {
+		csr, err := GenerateCSRWithKey(countryCode, orgName, orgID, commonName, []qcstatements.Role{role}, qcType, priv, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate csr for role %s: %v", string(role), err)
+		}
+		csrs[role] = csr
+	}
+	return csrs, nil
+}
+
+// validateQCType checks that t is one of the QcTypes CSRs can be generated
+// for.
+func validateQCType(t asn1.ObjectIdentifier) error {
+	if t.Equal(qcstatements.QWACType) || t.Equal(qcstatements.QSEALType) {
+		return nil
+	}
+	return fmt.Errorf("eidas: unsupported QC type %v: must be qcstatements.QWACType (%v) or qcstatements.QSEALType (%v)", t, qcstatements.QWACType, qcstatements.QSEALType)
+}
+
 func keyUsageForType(t asn1.ObjectIdentifier) ([]x509.KeyUsage, error) {
 	if t.Equal(qcstatements.QWACType) {
 		return []x509.KeyUsage{
@@ -112,15 +1031,28 @@ func keyUsageForType(t asn1.ObjectIdentifier) ([]x509.KeyUsage, error) {
 }
 
 func keyUsageExtension(usages []x509.KeyUsage) pkix.Extension {
-	x := uint16(0)
+	var ku x509.KeyUsage
 	for _, usage := range usages {
-		x |= (uint16(1) << (8 - uint(usage)))
+		ku |= usage
+	}
+	// Bit n of the key usage (digitalSignature(0) to decipherOnly(8)) is the
+	// nth most significant bit of the BIT STRING. DER requires trailing zero
+	// bits to be trimmed, so the BIT STRING ends at the highest set bit.
+	bitLength := 0
+	for i := 0; i < 9; i++ {
+		if ku&(1<<uint(i)) != 0 {
+			bitLength = i + 1
+		}
+	}
+	b := make([]byte, (bitLength+7)/8)
+	for i := 0; i < bitLength; i++ {
+		if ku&(1<<uint(i)) != 0 {
+			b[i/8] |= 0x80 >> uint(i%8)
+		}
 	}
-	b := make([]byte, 2)
-	binary.LittleEndian.PutUint16(b, x)
 	bits := asn1.BitString{
 		Bytes:     b,
-		BitLength: int(x509.KeyUsageDecipherOnly),
+		BitLength: bitLength,
 	}
 	d, _ := asn1.Marshal(bits)
 	return pkix.Extension{
@@ -130,6 +1062,9 @@ func keyUsageExtension(usages []x509.KeyUsage) pkix.Extension {
 	}
 }
 
+// extendedKeyUsageForType returns the default extended key usages for a
+// QcType. QSEALs have none, so by default their CSRs have no extKeyUsage
+// extension at all rather than an empty one.
 func extendedKeyUsageForType(t asn1.ObjectIdentifier) ([]asn1.ObjectIdentifier, error) {
 	if t.Equal(qcstatements.QWACType) {
 		return []asn1.ObjectIdentifier{
@@ -142,6 +1077,34 @@ func extendedKeyUsageForType(t asn1.ObjectIdentifier) ([]asn1.ObjectIdentifier,
 	return nil, fmt.Errorf("unknown QC type: %v", t)
 }
 
+func filterExtendedKeyUsage(usages []asn1.ObjectIdentifier, o *certificateOptions) []asn1.ObjectIdentifier {
+	var filtered []asn1.ObjectIdentifier
+	for _, usage := range usages {
+		if usage.Equal(tLSWWWServerAuthUsage) && !o.serverAuth {
+			continue
+		}
+		if usage.Equal(tLSWWWClientAuthUsage) && !o.clientAuth {
+			continue
+		}
+		filtered = append(filtered, usage)
+	}
+	for _, usage := range o.extKeyUsages {
+		if !containsOID(filtered, usage) {
+			filtered = append(filtered, usage)
+		}
+	}
+	return filtered
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if o.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
+
 var (
 	tLSWWWServerAuthUsage = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}
 	tLSWWWClientAuthUsage = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}
@@ -157,27 +1120,143 @@ func extendedKeyUsageExtension(usages []asn1.ObjectIdentifier) pkix.Extension {
 	}
 }
 
-func subjectKeyIdentifier(key *rsa.PublicKey) pkix.Extension {
-	b := sha1.Sum(x509.MarshalPKCS1PublicKey(key))
-	d, err := asn1.Marshal(b[:])
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// subjectAltNameExtension encodes the DNS names followed by the directory
+// names as GeneralNames, as described in RFC 5280 Section 4.2.1.6.
+func subjectAltNameExtension(dnsNames []string, dirNames []pkix.Name) (pkix.Extension, error) {
+	var names []asn1.RawValue
+	for _, name := range dnsNames {
+		if !isASCII(name) {
+			return pkix.Extension{}, fmt.Errorf("invalid DNS name %q: must be ASCII", name)
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, Bytes: []byte(name)})
+	}
+	for _, name := range dirNames {
+		d, err := asn1.Marshal(name.ToRDNSequence())
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("failed to marshal directory name: %v", err)
+		}
+		names = append(names, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: d})
+	}
+	d, err := asn1.Marshal(names)
 	if err != nil {
-		log.Fatalf("failed to marshal subject key identifier: %v", err)
+		return pkix.Extension{}, fmt.Errorf("failed to marshal subject alternative name: %v", err)
 	}
 
 	return pkix.Extension{
-		Id:       asn1.ObjectIdentifier{2, 5, 29, 14},
+		Id:       asn1.ObjectIdentifier{2, 5, 29, 17},
 		Critical: false,
 		Value:    d,
+	}, nil
+}
+
+// subjectKeyIdentifier computes the key identifier from the subjectPublicKey
+// BIT STRING of the key's SubjectPublicKeyInfo, as described in RFC 5280
+// Section 4.2.1.2. For RSA keys this is the PKCS#1 encoding of the key.
+func subjectKeyIdentifier(pub crypto.PublicKey, hash crypto.Hash) (pkix.Extension, error) {
+	spkiDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
 	}
+	if _, err := asn1.Unmarshal(spkiDER, &spki); err != nil {
+		return pkix.Extension{}, fmt.Errorf("failed to parse public key: %v", err)
+	}
+
+	h := hash.New()
+	h.Write(spki.PublicKey.Bytes)
+	// Truncate to the leftmost 160 bits, which is a no-op for SHA-1.
+	b := h.Sum(nil)[:20]
+	d, err := asn1.Marshal(b)
+	if err != nil {
+		return pkix.Extension{}, fmt.Errorf("failed to marshal subject key identifier: %v", err)
+	}
+
+	return pkix.Extension{
+		Id:       asn1.ObjectIdentifier{2, 5, 29, 14},
+		Critical: false,
+		Value:    d,
+	}, nil
 }
 
 // QCStatementsExt represents the qcstatements x509 extension id.
-var QCStatementsExt = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+var QCStatementsExt = qcstatements.ExtensionID
+
+// SerializeQCStatements returns the DER encoded qualified statements that
+// would be included in a CSR for the given country, roles and QC type,
+// without building the CSR.
+func SerializeQCStatements(countryCode string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, opts ...CertificateOption) ([]byte, error) {
+	o := newCertificateOptions(opts)
+	if o.err != nil {
+		return nil, o.err
+	}
+	return serializeQCStatements(countryCode, roles, qcType, o)
+}
+
+func serializeQCStatements(countryCode string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, o *certificateOptions) ([]byte, error) {
+	authority, err := competentAuthority(countryCode, o)
+	if err != nil {
+		return nil, err
+	}
+	types := append([]asn1.ObjectIdentifier{qcType}, o.qcTypes...)
+	qc, err := qcstatements.SerializeTypes(roles, authority, types, o.qcOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("eidas: %v", err)
+	}
+	return qc, nil
+}
 
-func qcStatementsExtension(data []byte) pkix.Extension {
+// competentAuthority returns the authority for the PSD2 statement, applying
+// any overrides from the options.
+func competentAuthority(countryCode string, o *certificateOptions) (qcstatements.CompetentAuthority, error) {
+	var authority qcstatements.CompetentAuthority
+	if o.ca != nil {
+		authority = *o.ca
+	} else {
+		ca, err := qcstatements.CompetentAuthorityForCountryCode(countryCode)
+		if err != nil {
+			return authority, fmt.Errorf("eidas: %v", err)
+		}
+		authority = *ca
+	}
+	if o.caLang != "" {
+		authority.Name = authority.LocalizedName(o.caLang)
+	}
+	if o.caName != "" {
+		authority.Name = o.caName
+	}
+	return authority, nil
+}
+
+// checkOrgIDAuthority checks that a PSD2 organization identifier of the form
+// "PSD" + country + "-" + NCA + "-" + identifier, e.g. "PSDGB-FCA-123456",
+// names the given authority. Other forms of identifier are not checked.
+func checkOrgIDAuthority(orgID string, ca qcstatements.CompetentAuthority) error {
+	if !strings.HasPrefix(orgID, "PSD") {
+		return nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(orgID, "PSD"), "-", 3)
+	if len(parts) != 3 || parts[0]+"-"+parts[1] != ca.ID {
+		return ErrOrgIDAuthorityMismatch
+	}
+	return nil
+}
+
+func qcStatementsExtension(data []byte, critical bool) pkix.Extension {
 	return pkix.Extension{
 		Id:       QCStatementsExt,
-		Critical: false,
+		Critical: critical,
 		Value:    data,
 	}
 }
@@ -186,28 +1265,142 @@ var oidCountryCode = asn1.ObjectIdentifier{2, 5, 4, 6}
 var oidOrganizationName = asn1.ObjectIdentifier{2, 5, 4, 10}
 var oidOrganizationID = asn1.ObjectIdentifier{2, 5, 4, 97}
 var oidCommonName = asn1.ObjectIdentifier{2, 5, 4, 3}
+var oidSerialNumber = asn1.ObjectIdentifier{2, 5, 4, 5}
+var oidBusinessCategory = asn1.ObjectIdentifier{2, 5, 4, 15}
+var oidJurisdictionCountry = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 60, 2, 1, 3}
+var oidGivenName = asn1.ObjectIdentifier{2, 5, 4, 42}
+var oidSurname = asn1.ObjectIdentifier{2, 5, 4, 4}
 
 // Explicitly build subject from attributes to keep ordering.
-func buildSubject(countryCode string, orgName string, commonName string, orgID string) ([]byte, error) {
-	s := pkix.Name{
-		ExtraNames: []pkix.AttributeTypeAndValue{
-			{
-				Type:  oidCountryCode,
-				Value: countryCode,
-			},
-			{
-				Type:  oidOrganizationName,
-				Value: orgName,
-			},
-			{
-				Type:  oidOrganizationID,
-				Value: orgID,
-			},
-			{
-				Type:  oidCommonName,
-				Value: commonName,
-			},
+func buildSubject(countryCode string, orgName string, commonName string, orgID string, o *certificateOptions) ([]byte, error) {
+	if o.rawSubject != nil {
+		return asn1.Marshal(o.rawSubject.ToRDNSequence())
+	}
+	if utf8.RuneCountInString(commonName) > maxCommonNameLength {
+		if !o.truncateCommonName {
+			return nil, ErrCommonNameTooLong
+		}
+		commonName = string([]rune(commonName)[:maxCommonNameLength])
+	}
+	names := []pkix.AttributeTypeAndValue{
+		{
+			Type:  oidCountryCode,
+			Value: countryCode,
 		},
 	}
+	for _, code := range o.additionalCountries {
+		names = append(names, pkix.AttributeTypeAndValue{
+			Type:  oidCountryCode,
+			Value: code,
+		})
+	}
+	if o.subjectType == NaturalPerson {
+		if o.givenName != "" {
+			names = append(names, pkix.AttributeTypeAndValue{
+				Type:  oidGivenName,
+				Value: o.givenName,
+			})
+		}
+		if o.surname != "" {
+			names = append(names, pkix.AttributeTypeAndValue{
+				Type:  oidSurname,
+				Value: o.surname,
+			})
+		}
+	} else {
+		names = append(names, pkix.AttributeTypeAndValue{
+			Type:  oidOrganizationName,
+			Value: orgName,
+		})
+		for _, name := range o.additionalOrgNames {
+			names = append(names, pkix.AttributeTypeAndValue{
+				Type:  oidOrganizationName,
+				Value: name,
+			})
+		}
+	}
+	orgIDValue, err := stringValue(orgID, o.orgIDStringTag)
+	if err != nil {
+		return nil, fmt.Errorf("organization identifier %v", err)
+	}
+	orgIDType := oidOrganizationID
+	if o.legacyOrgIDLocation {
+		if o.serialNumber != "" {
+			return nil, errors.New("eidas: WithLegacyOrgIDLocation can't be combined with WithSubjectSerialNumber")
+		}
+		orgIDType = oidSerialNumber
+	}
+	names = append(names, pkix.AttributeTypeAndValue{
+		Type:  orgIDType,
+		Value: orgIDValue,
+	})
+	if o.serialNumber != "" {
+		names = append(names, pkix.AttributeTypeAndValue{
+			Type:  oidSerialNumber,
+			Value: o.serialNumber,
+		})
+	}
+	if o.businessCategory != "" {
+		names = append(names, pkix.AttributeTypeAndValue{
+			Type:  oidBusinessCategory,
+			Value: o.businessCategory,
+		})
+	}
+	if o.jurisdiction != "" {
+		names = append(names, pkix.AttributeTypeAndValue{
+			Type:  oidJurisdictionCountry,
+			Value: o.jurisdiction,
+		})
+	}
+	commonNameValue, err := stringValue(commonName, o.commonNameStringTag)
+	if err != nil {
+		return nil, fmt.Errorf("common name %v", err)
+	}
+	names = append(names, pkix.AttributeTypeAndValue{
+		Type:  oidCommonName,
+		Value: commonNameValue,
+	})
+	s := pkix.Name{
+		ExtraNames: names,
+	}
 	return asn1.Marshal(s.ToRDNSequence())
 }
+
+// stringValue returns an attribute value encoding s with the given ASN.1
+// string tag, or s itself if tag is 0 so that encoding/asn1 picks the type.
+func stringValue(s string, tag int) (interface{}, error) {
+	switch tag {
+	case asn1.TagPrintableString:
+		if !isPrintableString(s) {
+			return nil, fmt.Errorf("%q can't be encoded as a PrintableString", s)
+		}
+		return asn1.RawValue{Tag: asn1.TagPrintableString, Bytes: []byte(s)}, nil
+	case asn1.TagUTF8String:
+		return asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(s)}, nil
+	}
+	return s, nil
+}
+
+// isPrintableString reports whether s only has characters allowed in an ASN.1
+// PrintableString.
+func isPrintableString(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune(" '()+,-./:=?", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// nameAttribute returns the first string value of the attribute with the given
+// type in the ExtraNames or Names of a subject, or "" if there is none.
+func nameAttribute(name *pkix.Name, oid asn1.ObjectIdentifier) string {
+	for _, names := range [][]pkix.AttributeTypeAndValue{name.ExtraNames, name.Names} {
+		for _, atv := range names {
+			if v, ok := atv.Value.(string); ok && atv.Type.Equal(oid) {
+				return v
+			}
+		}
+	}
+	return ""
+}
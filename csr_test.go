@@ -1,16 +1,28 @@
 package eidas
 
 import (
+	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/apple/eidas/internal/pkcs10"
 	"github.com/apple/eidas/qcstatements"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -33,6 +45,67 @@ func TestKeyUsage(t *testing.T) {
 	})
 }
 
+// parseKeyUsage decodes a key usage extension by embedding it in a
+// self-signed certificate and parsing it with crypto/x509.
+func parseKeyUsage(ext pkix.Extension) x509.KeyUsage {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	So(err, ShouldBeNil)
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{ext},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	So(err, ShouldBeNil)
+	cert, err := x509.ParseCertificate(der)
+	So(err, ShouldBeNil)
+	return cert.KeyUsage
+}
+
+func TestKeyUsageExtension(t *testing.T) {
+	Convey("QWAC key usage decodes to DigitalSignature", t, func() {
+		usage, err := keyUsageForType(qcstatements.QWACType)
+		So(err, ShouldBeNil)
+		So(parseKeyUsage(keyUsageExtension(usage)), ShouldEqual, x509.KeyUsageDigitalSignature)
+	})
+
+	Convey("QSEAL key usage decodes to DigitalSignature and ContentCommitment", t, func() {
+		usage, err := keyUsageForType(qcstatements.QSEALType)
+		So(err, ShouldBeNil)
+		So(parseKeyUsage(keyUsageExtension(usage)), ShouldEqual, x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment)
+	})
+
+	Convey("every key usage bit decodes to itself", t, func() {
+		for usage := x509.KeyUsageDigitalSignature; usage <= x509.KeyUsageDecipherOnly; usage <<= 1 {
+			So(parseKeyUsage(keyUsageExtension([]x509.KeyUsage{usage})), ShouldEqual, usage)
+		}
+	})
+}
+
+func TestKeyUsageEncoding(t *testing.T) {
+	// Expected encodings are as produced by OpenSSL for the equivalent keyUsage.
+	Convey("digitalSignature", t, func() {
+		ext := keyUsageExtension([]x509.KeyUsage{x509.KeyUsageDigitalSignature})
+		So(hex.EncodeToString(ext.Value), ShouldEqual, "03020780")
+	})
+
+	Convey("digitalSignature, nonRepudiation", t, func() {
+		ext := keyUsageExtension([]x509.KeyUsage{x509.KeyUsageDigitalSignature, x509.KeyUsageContentCommitment})
+		So(hex.EncodeToString(ext.Value), ShouldEqual, "030206c0")
+	})
+
+	Convey("digitalSignature, keyEncipherment", t, func() {
+		ext := keyUsageExtension([]x509.KeyUsage{x509.KeyUsageDigitalSignature, x509.KeyUsageKeyEncipherment})
+		So(hex.EncodeToString(ext.Value), ShouldEqual, "030205a0")
+	})
+
+	Convey("decipherOnly", t, func() {
+		ext := keyUsageExtension([]x509.KeyUsage{x509.KeyUsageDecipherOnly})
+		So(hex.EncodeToString(ext.Value), ShouldEqual, "0303070080")
+	})
+}
+
 func TestExtendedKeyUsage(t *testing.T) {
 	Convey("extended key usage for QWAC", t, func() {
 		usage, err := extendedKeyUsageForType(qcstatements.QWACType)
@@ -44,9 +117,64 @@ func TestExtendedKeyUsage(t *testing.T) {
 	})
 }
 
+func TestExtendedKeyUsageOptions(t *testing.T) {
+	extKeyUsage := func(opts ...CertificateOption) []asn1.ObjectIdentifier {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, append([]CertificateOption{WithDNSName("example.com")}, opts...)...)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 37}) {
+				var usages []asn1.ObjectIdentifier
+				_, err := asn1.Unmarshal(ext.Value, &usages)
+				So(err, ShouldBeNil)
+				return usages
+			}
+		}
+		return nil
+	}
+
+	Convey("QWAC has server and client auth by default", t, func() {
+		So(extKeyUsage(), ShouldResemble, []asn1.ObjectIdentifier{tLSWWWServerAuthUsage, tLSWWWClientAuthUsage})
+	})
+
+	Convey("QWAC with server auth only", t, func() {
+		So(extKeyUsage(WithClientAuth(false)), ShouldResemble, []asn1.ObjectIdentifier{tLSWWWServerAuthUsage})
+	})
+
+	Convey("QWAC with client auth only", t, func() {
+		So(extKeyUsage(WithServerAuth(false)), ShouldResemble, []asn1.ObjectIdentifier{tLSWWWClientAuthUsage})
+	})
+
+	Convey("QWAC with neither omits the extension", t, func() {
+		So(extKeyUsage(WithServerAuth(false), WithClientAuth(false)), ShouldBeNil)
+	})
+
+	Convey("QWAC with additional usages merged with the defaults", t, func() {
+		emailProtection := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}
+		So(extKeyUsage(WithExtendedKeyUsage([]asn1.ObjectIdentifier{tLSWWWClientAuthUsage, emailProtection})), ShouldResemble, []asn1.ObjectIdentifier{tLSWWWServerAuthUsage, tLSWWWClientAuthUsage, emailProtection})
+	})
+
+	Convey("QSEAL with emailProtection", t, func() {
+		emailProtection := asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithExtendedKeyUsage([]asn1.ObjectIdentifier{emailProtection}))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		var usages []asn1.ObjectIdentifier
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(oidExtensionExtendedKeyUsage) {
+				_, err := asn1.Unmarshal(ext.Value, &usages)
+				So(err, ShouldBeNil)
+			}
+		}
+		So(usages, ShouldResemble, []asn1.ObjectIdentifier{emailProtection})
+	})
+}
+
 func TestBuildCSR(t *testing.T) {
 	Convey("CSR for QWAC", t, func() {
-		data, key, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType)
+		data, key, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
 		So(err, ShouldBeNil)
 		So(key, ShouldNotBeNil)
 		csr, err := x509.ParseCertificateRequest(data)
@@ -98,36 +226,1278 @@ func TestBuildCSR(t *testing.T) {
 		So(csr.DNSNames, ShouldResemble, []string{"foo.example.com", "bar.example.com"})
 	})
 
+	Convey("CSR with DNS names", t, func() {
+		domains := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com", "e.example.com"}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSNames(domains...))
+		So(err, ShouldBeNil)
+
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.DNSNames, ShouldResemble, domains)
+	})
+
+	Convey("CSR with invalid DNS names", t, func() {
+		for _, domain := range []string{"", "foo..example.com", "-foo.example.com", "foo_bar.example.com", strings.Repeat("a", 64) + ".com"} {
+			data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSNames("foo.example.com", domain))
+			So(err, ShouldNotBeNil)
+			So(data, ShouldBeNil)
+		}
+	})
+
 	Convey("CSR with existing key", t, func() {
 		key, err := rsa.GenerateKey(rand.Reader, 2048)
 		So(err, ShouldBeNil)
-		data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key)
+		data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithDNSName("example.com"))
 		So(err, ShouldBeNil)
 		So(data, ShouldNotBeNil)
 	})
 
+	Convey("CSR with a weak key", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		So(err, ShouldBeNil)
+		data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithDNSName("example.com"))
+		So(err, ShouldEqual, ErrWeakKey)
+		So(data, ShouldBeNil)
+	})
+
 	Convey("CSR with incorrect key type", t, func() {
-		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
 		So(err, ShouldBeNil)
-		data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key)
-		So(err, ShouldBeError, "only RSA keys are currently supported but got: *ecdsa.PublicKey")
+		data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithDNSName("example.com"))
+		So(err, ShouldBeError, "unsupported elliptic curve: P-224")
 		So(data, ShouldBeNil)
 	})
 }
 
-func shouldContainID(actual interface{}, expected ...interface{}) string {
-	exts, ok := actual.([]pkix.Extension)
-	if !ok {
-		return "Expected []x509.Extension"
+func TestGenerateCSRWithAlgorithm(t *testing.T) {
+	for _, tc := range []struct {
+		Name               string
+		Algorithm          KeyAlgorithm
+		PublicKeyAlgorithm x509.PublicKeyAlgorithm
+		SignatureAlgorithm x509.SignatureAlgorithm
+	}{
+		{"RSA2048", RSA2048, x509.RSA, x509.SHA256WithRSA},
+		{"RSA4096", RSA4096, x509.RSA, x509.SHA256WithRSA},
+		{"ECP256", ECP256, x509.ECDSA, x509.ECDSAWithSHA256},
+		{"Ed25519", Ed25519, x509.Ed25519, x509.PureEd25519},
+	} {
+		Convey("CSR with "+tc.Name+" key", t, func() {
+			data, key, err := GenerateCSRWithAlgorithm(tc.Algorithm, "GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithChallengePassword("s3cret"))
+			So(err, ShouldBeNil)
+			So(key, ShouldNotBeNil)
+			csr, err := x509.ParseCertificateRequest(data)
+			So(err, ShouldBeNil)
+			So(csr.CheckSignature(), ShouldBeNil)
+			So(csr.PublicKeyAlgorithm, ShouldEqual, tc.PublicKeyAlgorithm)
+			So(csr.SignatureAlgorithm, ShouldEqual, tc.SignatureAlgorithm)
+			So(csr.Extensions, shouldContainID, QCStatementsExt)
+		})
 	}
-	ex, ok := expected[0].(asn1.ObjectIdentifier)
-	if !ok {
-		return "Expected asn1.ObjectIdentifier"
+
+	Convey("unknown key algorithm", t, func() {
+		data, key, err := GenerateCSRWithAlgorithm(KeyAlgorithm(-1), "GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType)
+		So(err, ShouldNotBeNil)
+		So(key, ShouldBeNil)
+		So(data, ShouldBeNil)
+	})
+}
+
+func TestGenerateCSRPerRole(t *testing.T) {
+	Convey("one CSR per role", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		roles := []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation}
+		csrs, err := GenerateCSRPerRole("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, key, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(csrs, ShouldHaveLength, 2)
+
+		for _, role := range roles {
+			csr, err := x509.ParseCertificateRequest(csrs[role])
+			So(err, ShouldBeNil)
+			So(key.PublicKey.Equal(csr.PublicKey), ShouldBeTrue)
+			So(csr.Extensions, shouldContainID, QCStatementsExt)
+			for _, ext := range csr.Extensions {
+				if ext.Id.Equal(QCStatementsExt) {
+					got, _, _, err := qcstatements.Extract(ext.Value)
+					So(err, ShouldBeNil)
+					So(got, ShouldResemble, []qcstatements.Role{role})
+				}
+			}
+		}
+	})
+
+	Convey("unknown role", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		csrs, err := GenerateCSRPerRole("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{"PSP_XX"}, qcstatements.QWACType, key, WithDNSName("example.com"))
+		So(err, ShouldNotBeNil)
+		So(csrs, ShouldBeNil)
+	})
+}
+
+func TestAdditionalOrganizationName(t *testing.T) {
+	Convey("CSR with trading name", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org Limited", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithAdditionalOrganizationName("Foo"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.Organization, ShouldResemble, []string{"Foo Org Limited", "Foo"})
+
+		names := csr.Subject.Names
+		So(names, ShouldHaveLength, 5)
+		So(names[0].Type, ShouldEqual, oidCountryCode)
+		So(names[1].Type, ShouldEqual, oidOrganizationName)
+		So(names[2].Type, ShouldEqual, oidOrganizationName)
+		So(names[3].Type, ShouldEqual, oidOrganizationID)
+		So(names[4].Type, ShouldEqual, oidCommonName)
+	})
+}
+
+func TestAdditionalCountry(t *testing.T) {
+	Convey("CSR with two countries", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithAdditionalCountry("IE"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.Country, ShouldResemble, []string{"GB", "IE"})
+
+		names := csr.Subject.Names
+		So(names, ShouldHaveLength, 5)
+		So(names[0].Type, ShouldEqual, oidCountryCode)
+		So(names[1].Type, ShouldEqual, oidCountryCode)
+		So(names[2].Type, ShouldEqual, oidOrganizationName)
+	})
+
+	Convey("CSR with an invalid additional country", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithAdditionalCountry("XX"))
+		So(errors.Is(err, ErrInvalidCountryCode), ShouldBeTrue)
+	})
+}
+
+func TestSubjectSerialNumber(t *testing.T) {
+	Convey("CSR with subject serial number", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSubjectSerialNumber("12345678"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.SerialNumber, ShouldEqual, "12345678")
+
+		names := csr.Subject.Names
+		So(names, ShouldHaveLength, 5)
+		So(names[3].Type, ShouldEqual, oidSerialNumber)
+		So(names[4].Type, ShouldEqual, oidCommonName)
+	})
+}
+
+func TestEVSubjectAttributes(t *testing.T) {
+	Convey("CSR with businessCategory and jurisdiction", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithBusinessCategory("Private Organization"), WithJurisdictionCountry("GB"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+
+		var rdns pkix.RDNSequence
+		_, err = asn1.Unmarshal(csr.RawSubject, &rdns)
+		So(err, ShouldBeNil)
+		values := map[string]interface{}{}
+		for _, rdn := range rdns {
+			for _, atv := range rdn {
+				values[atv.Type.String()] = atv.Value
+			}
+		}
+		So(values[oidBusinessCategory.String()], ShouldEqual, "Private Organization")
+		So(values[oidJurisdictionCountry.String()], ShouldEqual, "GB")
+	})
+}
+
+func TestSerializeQCStatements(t *testing.T) {
+	Convey("QCStatements DER without a CSR", t, func() {
+		data, err := SerializeQCStatements("GB", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType)
+		So(err, ShouldBeNil)
+
+		var statements []struct {
+			ID   asn1.ObjectIdentifier
+			Info asn1.RawValue
+		}
+		rest, err := asn1.Unmarshal(data, &statements)
+		So(err, ShouldBeNil)
+		So(rest, ShouldBeEmpty)
+		So(statements, ShouldHaveLength, 2)
+		So(statements[0].ID, ShouldResemble, qcstatements.QcTypeOID)
+		So(statements[1].ID, ShouldResemble, qcstatements.PSD2OID)
+	})
+
+	Convey("unknown country", t, func() {
+		data, err := SerializeQCStatements("XX", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType)
+		So(err, ShouldNotBeNil)
+		So(data, ShouldBeNil)
+	})
+}
+
+func TestCompetentAuthorityName(t *testing.T) {
+	Convey("QCStatements with localized competent authority name", t, func() {
+		name := "Bundesanstalt für Finanzdienstleistungsaufsicht"
+		data, err := SerializeQCStatements("DE", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithCompetentAuthorityName(name))
+		So(err, ShouldBeNil)
+		_, caName, caID, err := qcstatements.Extract(data)
+		So(err, ShouldBeNil)
+		So(caName, ShouldEqual, name)
+		So(caID, ShouldEqual, "DE-BAFIN")
+	})
+}
+
+func TestOBNamingPolicy(t *testing.T) {
+	Convey("compliant common name", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "PSDGB-FCA-123456", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithOBNamingPolicy(), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(data, ShouldNotBeNil)
+	})
+
+	Convey("non-compliant common name", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithOBNamingPolicy(), WithDNSName("example.com"))
+		So(err, ShouldEqual, ErrOBNamingPolicy)
+		So(data, ShouldBeNil)
+	})
+}
+
+func TestChallengePassword(t *testing.T) {
+	Convey("CSR with challenge password", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithChallengePassword("s3cret"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.CheckSignature(), ShouldBeNil)
+		// Extensions must survive re-signing.
+		So(csr.Extensions, shouldContainID, QCStatementsExt)
+
+		// crypto/x509 skips attributes it can't represent, so decode them directly.
+		var tbs pkcs10.TBSCertificateRequest
+		_, err = asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs)
+		So(err, ShouldBeNil)
+		var password string
+		for _, raw := range tbs.RawAttributes {
+			var attr pkcs10.Attribute
+			_, err := asn1.Unmarshal(raw.FullBytes, &attr)
+			So(err, ShouldBeNil)
+			if attr.Type.Equal(pkcs10.OIDChallengePassword) {
+				So(attr.Values, ShouldHaveLength, 1)
+				_, err := asn1.Unmarshal(attr.Values[0].FullBytes, &password)
+				So(err, ShouldBeNil)
+			}
+		}
+		So(password, ShouldEqual, "s3cret")
+	})
+}
+
+func TestSignatureAlgorithm(t *testing.T) {
+	Convey("CSR signed with RSA-PSS", t, func() {
+		for _, alg := range []x509.SignatureAlgorithm{x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS} {
+			data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSignatureAlgorithm(alg), WithDNSName("example.com"))
+			So(err, ShouldBeNil)
+			csr, err := x509.ParseCertificateRequest(data)
+			So(err, ShouldBeNil)
+			So(csr.SignatureAlgorithm, ShouldEqual, alg)
+			So(csr.CheckSignature(), ShouldBeNil)
+		}
+	})
+
+	Convey("CSR signed with RSA PKCS#1 v1.5", t, func() {
+		for alg, oid := range map[x509.SignatureAlgorithm]string{
+			x509.SHA384WithRSA: "1.2.840.113549.1.1.12",
+			x509.SHA512WithRSA: "1.2.840.113549.1.1.13",
+		} {
+			data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSignatureAlgorithm(alg), WithChallengePassword("s3cret"), WithDNSName("example.com"))
+			So(err, ShouldBeNil)
+			csr, err := x509.ParseCertificateRequest(data)
+			So(err, ShouldBeNil)
+			So(csr.SignatureAlgorithm, ShouldEqual, alg)
+			So(csr.CheckSignature(), ShouldBeNil)
+
+			var raw pkcs10.CertificateRequest
+			_, err = asn1.Unmarshal(data, &raw)
+			So(err, ShouldBeNil)
+			So(raw.SignatureAlgorithm.Algorithm.String(), ShouldEqual, oid)
+		}
+	})
+
+	Convey("RSA-PSS CSR with attributes is re-signed with RSA-PSS", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSignatureAlgorithm(x509.SHA256WithRSAPSS), WithChallengePassword("s3cret"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.SignatureAlgorithm, ShouldEqual, x509.SHA256WithRSAPSS)
+		So(csr.CheckSignature(), ShouldBeNil)
+	})
+
+	Convey("signature algorithm incompatible with RSA key", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSignatureAlgorithm(x509.ECDSAWithSHA256), WithDNSName("example.com"))
+		So(err, ShouldNotBeNil)
+		So(data, ShouldBeNil)
+	})
+
+	Convey("RSA signature algorithm incompatible with ECDSA key", t, func() {
+		data, _, err := GenerateCSRWithAlgorithm(ECP256, "GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSignatureAlgorithm(x509.SHA384WithRSA), WithDNSName("example.com"))
+		So(err, ShouldNotBeNil)
+		So(data, ShouldBeNil)
+	})
+}
+
+func TestSubjectKeyIdentifierHash(t *testing.T) {
+	n, _ := new(big.Int).SetString("c"+strings.Repeat("3", 255), 16)
+	key := &rsa.PublicKey{N: n, E: 65537}
+
+	for _, tc := range []struct {
+		Hash     crypto.Hash
+		Expected string
+	}{
+		{crypto.SHA1, "977d5c9670bed89db29d0ed3e93220bdcf5e9280"},
+		{crypto.SHA256, "677508631ef77bf798bd82cb3d0fbbef82f90908"},
+		{crypto.SHA384, "6e721fb21e2ae24acfe0aaba2a10d66543a3ff6a"},
+		{crypto.SHA512, "568b6282ba53eaa1204ade006e4f136542611e93"},
+	} {
+		Convey("subject key identifier with "+tc.Hash.String(), t, func() {
+			ext, err := subjectKeyIdentifier(key, tc.Hash)
+			So(err, ShouldBeNil)
+			var ski []byte
+			_, err = asn1.Unmarshal(ext.Value, &ski)
+			So(err, ShouldBeNil)
+			So(ski, ShouldHaveLength, 20)
+			So(hex.EncodeToString(ski), ShouldEqual, tc.Expected)
+		})
 	}
-	for _, ext := range exts {
-		if ext.Id.Equal(ex) {
-			return ""
+
+	Convey("CSR with SHA-256 subject key identifier", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSubjectKeyIdentifierHash(crypto.SHA256), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(data, ShouldNotBeNil)
+	})
+
+	Convey("unsupported subject key identifier hash", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithSubjectKeyIdentifierHash(crypto.MD5), WithDNSName("example.com"))
+		So(err, ShouldNotBeNil)
+		So(data, ShouldBeNil)
+	})
+}
+
+func TestGenerateOBPair(t *testing.T) {
+	Convey("QWAC and QSEAL sharing a subject", t, func() {
+		pair, err := GenerateOBPair("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+
+		qwac, err := x509.ParseCertificateRequest(pair.QWAC)
+		So(err, ShouldBeNil)
+		qseal, err := x509.ParseCertificateRequest(pair.QSEAL)
+		So(err, ShouldBeNil)
+		So(qwac.RawSubject, ShouldResemble, qseal.RawSubject)
+		So(pair.QWACKey.PublicKey.Equal(qwac.PublicKey), ShouldBeTrue)
+		So(pair.QSEALKey.PublicKey.Equal(qseal.PublicKey), ShouldBeTrue)
+		So(qwac.DNSNames, ShouldResemble, []string{"example.com"})
+		So(qseal.DNSNames, ShouldBeEmpty)
+
+		extension := func(csr *x509.CertificateRequest, id asn1.ObjectIdentifier) []byte {
+			for _, ext := range csr.Extensions {
+				if ext.Id.Equal(id) {
+					return ext.Value
+				}
+			}
+			return nil
+		}
+		keyUsageID := asn1.ObjectIdentifier{2, 5, 29, 15}
+		So(extension(qwac, keyUsageID), ShouldNotResemble, extension(qseal, keyUsageID))
+
+		qwacTypes, err := qcstatements.ExtractTypes(extension(qwac, QCStatementsExt))
+		So(err, ShouldBeNil)
+		So(qwacTypes, ShouldResemble, []asn1.ObjectIdentifier{qcstatements.QWACType})
+		qsealTypes, err := qcstatements.ExtractTypes(extension(qseal, QCStatementsExt))
+		So(err, ShouldBeNil)
+		So(qsealTypes, ShouldResemble, []asn1.ObjectIdentifier{qcstatements.QSEALType})
+	})
+}
+
+func TestTransactionLimit(t *testing.T) {
+	Convey("CSR with transaction limit", t, func() {
+		limit := qcstatements.MonetaryLimit{Amount: 1000000, Currency: "EUR"}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithTransactionLimit(limit))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(QCStatementsExt) {
+				got, err := qcstatements.ExtractLimit(ext.Value)
+				So(err, ShouldBeNil)
+				So(got, ShouldResemble, &limit)
+			}
+		}
+	})
+}
+
+func TestQCCompliance(t *testing.T) {
+	Convey("QWAC CSR with QcCompliance", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "example.com", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithQCCompliance(), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		// The statement has no statementInfo: SEQUENCE { OID 0.4.0.1862.1.1 }.
+		So(bytes.Contains(data, []byte{0x30, 0x08, 0x06, 0x06, 0x04, 0x00, 0x8e, 0x46, 0x01, 0x01}), ShouldBeTrue)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		ids, err := qcstatements.StatementOIDs(findQCStatements(csr.Extensions))
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []asn1.ObjectIdentifier{qcstatements.QcComplianceOID, qcstatements.QcTypeOID, qcstatements.PSD2OID})
+		So(LintCSR(data), ShouldBeEmpty)
+	})
+}
+
+func TestPDSLocation(t *testing.T) {
+	Convey("CSR with PDS location", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithPDSLocation("https://example.com/pds_en.pdf", "en"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		ids, err := qcstatements.StatementOIDs(findQCStatements(csr.Extensions))
+		So(err, ShouldBeNil)
+		So(ids, ShouldResemble, []asn1.ObjectIdentifier{qcstatements.QcTypeOID, qcstatements.PSD2OID, qcstatements.QcPDSOID})
+	})
+
+	Convey("CSR with invalid PDS language", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithPDSLocation("https://example.com/pds_en.pdf", "english"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCustomQCStatement(t *testing.T) {
+	Convey("CSR with custom QCStatement", t, func() {
+		id := asn1.ObjectIdentifier{1, 2, 3, 4, 5}
+		value := []byte{0x0c, 0x03, 'f', 'o', 'o'}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithCustomQCStatement(id, value), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		got, err := qcstatements.ExtractCustom(findQCStatements(csr.Extensions))
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, []qcstatements.RawStatement{{ID: id, Value: value}})
+	})
+}
+
+func TestQCStatementsCritical(t *testing.T) {
+	findQCStatements := func(data []byte) pkix.Extension {
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(QCStatementsExt) {
+				return ext
+			}
 		}
+		return pkix.Extension{}
 	}
-	return fmt.Sprintf("Expected to find: %v", expected)
+
+	Convey("qcStatements is non-critical by default", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		ext := findQCStatements(data)
+		So(ext.Id, ShouldResemble, QCStatementsExt)
+		So(ext.Critical, ShouldBeFalse)
+	})
+
+	Convey("qcStatements marked critical", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithQCStatementsCritical(true), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		ext := findQCStatements(data)
+		So(ext.Id, ShouldResemble, QCStatementsExt)
+		So(ext.Critical, ShouldBeTrue)
+	})
+}
+
+func TestKeyUsageCritical(t *testing.T) {
+	findKeyUsage := func(data []byte) pkix.Extension {
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 15}) {
+				return ext
+			}
+		}
+		return pkix.Extension{}
+	}
+
+	Convey("keyUsage is critical by default", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(findKeyUsage(data).Critical, ShouldBeTrue)
+	})
+
+	Convey("keyUsage marked non-critical", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithKeyUsageCritical(false), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		ext := findKeyUsage(data)
+		So(ext.Critical, ShouldBeFalse)
+		So(parseKeyUsage(ext), ShouldEqual, x509.KeyUsageDigitalSignature)
+	})
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("no randomness")
+}
+
+func TestRandSource(t *testing.T) {
+	Convey("CSR with deterministic rand source", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		generate := func() []byte {
+			data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithRandSource(mathrand.New(mathrand.NewSource(1))), WithDNSName("example.com"))
+			So(err, ShouldBeNil)
+			return data
+		}
+		So(generate(), ShouldResemble, generate())
+	})
+
+	Convey("Reproducible output with the same seed", t, func() {
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		So(err, ShouldBeNil)
+		notBefore := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		notAfter := notBefore.AddDate(1, 0, 0)
+
+		for _, key := range []crypto.Signer{rsaKey, edKey} {
+			generate := func() ([]byte, []byte) {
+				opts := []CertificateOption{
+					WithRandSource(mathrand.New(mathrand.NewSource(42))),
+					WithDNSName("example.com"),
+					WithChallengePassword("secret"),
+					WithValidity(notBefore, notAfter),
+				}
+				csr, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, opts...)
+				So(err, ShouldBeNil)
+				cert, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, opts...)
+				So(err, ShouldBeNil)
+				return csr, cert
+			}
+			csr1, cert1 := generate()
+			csr2, cert2 := generate()
+			So(csr1, ShouldResemble, csr2)
+			So(cert1, ShouldResemble, cert2)
+		}
+	})
+
+	Convey("key generation uses rand source", t, func() {
+		data, key, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithRandSource(errReader{}), WithDNSName("example.com"))
+		So(err, ShouldNotBeNil)
+		So(key, ShouldBeNil)
+		So(data, ShouldBeNil)
+	})
+}
+
+func shouldContainID(actual interface{}, expected ...interface{}) string {
+	exts, ok := actual.([]pkix.Extension)
+	if !ok {
+		return "Expected []x509.Extension"
+	}
+	ex, ok := expected[0].(asn1.ObjectIdentifier)
+	if !ok {
+		return "Expected asn1.ObjectIdentifier"
+	}
+	for _, ext := range exts {
+		if ext.Id.Equal(ex) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("Expected to find: %v", expected)
+}
+
+// cancellingSigner cancels its context when asked to sign.
+type cancellingSigner struct {
+	crypto.Signer
+	cancel context.CancelFunc
+}
+
+func (s cancellingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.cancel()
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestGenerateCSRWithKeyContext(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("cancelled before signing", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		data, err := GenerateCSRWithKeyContext(ctx, "GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, priv, WithDNSName("example.com"))
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(data, ShouldBeNil)
+	})
+
+	Convey("cancelled while signing", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		signer := cancellingSigner{Signer: priv, cancel: cancel}
+		data, err := GenerateCSRWithKeyContext(ctx, "GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, signer, WithDNSName("example.com"))
+		So(errors.Is(err, context.Canceled), ShouldBeTrue)
+		So(data, ShouldBeNil)
+	})
+
+	Convey("not cancelled", t, func() {
+		data, err := GenerateCSRWithKeyContext(context.Background(), "GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, priv, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		_, err = x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestOrgIDAuthority(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("matching organization identifier", t, func() {
+		_, _, err := GenerateCSR("DE", "Foo Org", "PSDDE-BAFIN-123456", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("mismatched organization identifier", t, func() {
+		for _, orgID := range []string{"PSDGB-FCA-123456", "PSDDE-FCA-123456", "PSDDE-BAFIN"} {
+			data, _, err := GenerateCSR("DE", "Foo Org", orgID, "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+			So(err, ShouldEqual, ErrOrgIDAuthorityMismatch)
+			So(data, ShouldBeNil)
+		}
+	})
+
+	Convey("non-PSD2 organization identifier", t, func() {
+		_, _, err := GenerateCSR("DE", "Foo Org", "VATDE-123456789", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("explicit competent authority bypasses the check", t, func() {
+		ca := qcstatements.CompetentAuthority{Name: "Foo Authority", ID: "XX-FOO", Country: "XX"}
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, WithCompetentAuthority(ca), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		_, name, id, err := qcstatements.Extract(findQCStatements(csr.Extensions))
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, ca.Name)
+		So(id, ShouldEqual, ca.ID)
+	})
+}
+
+func TestDirectoryNameSAN(t *testing.T) {
+	Convey("CSR with directoryName SAN", t, func() {
+		dirName := pkix.Name{Country: []string{"GB"}, Organization: []string{"Foo Org"}}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"), WithDirectoryNameSAN(dirName))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.DNSNames, ShouldResemble, []string{"example.com"})
+
+		var san []byte
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 17}) {
+				So(san, ShouldBeNil)
+				san = ext.Value
+			}
+		}
+		var names []asn1.RawValue
+		_, err = asn1.Unmarshal(san, &names)
+		So(err, ShouldBeNil)
+		So(names, ShouldHaveLength, 2)
+		So(names[0].Class, ShouldEqual, asn1.ClassContextSpecific)
+		So(names[0].Tag, ShouldEqual, 2)
+		So(names[1].Class, ShouldEqual, asn1.ClassContextSpecific)
+		So(names[1].Tag, ShouldEqual, 4)
+		So(names[1].IsCompound, ShouldBeTrue)
+
+		var rdns pkix.RDNSequence
+		_, err = asn1.Unmarshal(names[1].Bytes, &rdns)
+		So(err, ShouldBeNil)
+		var got pkix.Name
+		got.FillFromRDNSequence(&rdns)
+		So(got.Country, ShouldResemble, dirName.Country)
+		So(got.Organization, ShouldResemble, dirName.Organization)
+	})
+}
+
+func TestGenerateKey(t *testing.T) {
+	for _, algo := range []KeyAlgorithm{RSA2048, ECP256, Ed25519} {
+		Convey(fmt.Sprintf("key for algorithm %d", algo), t, func() {
+			key, err := GenerateKey(algo)
+			So(err, ShouldBeNil)
+			_, err = GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, key, WithDNSName("example.com"))
+			So(err, ShouldBeNil)
+		})
+	}
+
+	Convey("unknown key algorithm", t, func() {
+		key, err := GenerateKey(KeyAlgorithm(-1))
+		So(err, ShouldNotBeNil)
+		So(key, ShouldBeNil)
+	})
+}
+
+func BenchmarkGenerateCSR(b *testing.B) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	for i := 0; i < b.N; i++ {
+		if _, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateCSRWithKey(b *testing.B) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	key, err := GenerateKey(RSA2048)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, key, WithDNSName("example.com")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCountryCode(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("ISO 3166-1 alpha-2 table", t, func() {
+		So(iso3166Alpha2, ShouldHaveLength, 249)
+	})
+
+	Convey("valid country code", t, func() {
+		_, _, err := GenerateCSR("IE", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("invalid country codes", t, func() {
+		for _, code := range []string{"gb", "Gb", "UK", "GBR", "G", "", "XX"} {
+			data, _, err := GenerateCSR(code, "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+			So(err, ShouldEqual, ErrInvalidCountryCode)
+			So(data, ShouldBeNil)
+		}
+	})
+
+	Convey("valid country code without a competent authority", t, func() {
+		_, _, err := GenerateCSR("US", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldNotBeNil)
+		So(err, ShouldNotEqual, ErrInvalidCountryCode)
+	})
+}
+
+func TestWildcardDNSName(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("CSR with wildcard DNS name", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithWildcardDNSName("*.api.example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.CommonName, ShouldEqual, "*.api.example.com")
+		So(csr.DNSNames, ShouldResemble, []string{"*.api.example.com"})
+	})
+
+	Convey("malformed wildcard DNS names", t, func() {
+		for _, domain := range []string{"a.*.example.com", "*", "*.", "**.example.com", "*a.example.com", "api.example.com", "*.*.example.com"} {
+			data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithWildcardDNSName(domain))
+			So(err, ShouldNotBeNil)
+			So(data, ShouldBeNil)
+		}
+	})
+}
+
+func TestCompetentAuthorityLanguage(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	caName := func(data []byte) string {
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		_, name, _, err := qcstatements.Extract(findQCStatements(csr.Extensions))
+		So(err, ShouldBeNil)
+		return name
+	}
+
+	Convey("German name for BaFin", t, func() {
+		data, _, err := GenerateCSR("DE", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithCompetentAuthorityLanguage("de"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(caName(data), ShouldEqual, "Bundesanstalt für Finanzdienstleistungsaufsicht")
+	})
+
+	Convey("unknown language falls back to the default name", t, func() {
+		data, _, err := GenerateCSR("DE", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithCompetentAuthorityLanguage("fr"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(caName(data), ShouldEqual, "Federal Financial Supervisory Authority")
+	})
+}
+
+func TestRawSubject(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("CSR with raw subject", t, func() {
+		subject := pkix.Name{
+			Country:      []string{"GB"},
+			Organization: []string{"Bar Org"},
+			Locality:     []string{"London"},
+			CommonName:   "Bar Name",
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: oidOrganizationID, Value: "PSDGB-FCA-654321"},
+			},
+		}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithRawSubject(subject), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.Organization, ShouldResemble, []string{"Bar Org"})
+		So(csr.Subject.Locality, ShouldResemble, []string{"London"})
+		So(csr.Subject.CommonName, ShouldEqual, "Bar Name")
+		So(nameAttribute(&csr.Subject, oidOrganizationID), ShouldEqual, "PSDGB-FCA-654321")
+	})
+
+	Convey("raw subject without organization identifier", t, func() {
+		subject := pkix.Name{Country: []string{"GB"}, Organization: []string{"Bar Org"}, CommonName: "Bar Name"}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithRawSubject(subject), WithDNSName("example.com"))
+		So(err, ShouldEqual, ErrNoOrganizationIdentifier)
+		So(data, ShouldBeNil)
+	})
+
+	Convey("raw subject organization identifier is validated", t, func() {
+		subject := pkix.Name{
+			CommonName: "Bar Name",
+			ExtraNames: []pkix.AttributeTypeAndValue{{Type: oidOrganizationID, Value: "PSDDE-BAFIN-654321"}},
+		}
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, WithRawSubject(subject), WithDNSName("example.com"))
+		So(err, ShouldEqual, ErrOrgIDAuthorityMismatch)
+	})
+}
+
+func TestSubjectKeyIdentifierOmitted(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("subjectKeyIdentifier is included by default", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Extensions, shouldContainID, oidExtensionSubjectKeyID)
+	})
+
+	Convey("subjectKeyIdentifier disabled", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithSubjectKeyIdentifier(false), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		for _, ext := range csr.Extensions {
+			So(ext.Id, ShouldNotResemble, oidExtensionSubjectKeyID)
+		}
+		So(csr.Extensions, shouldContainID, QCStatementsExt)
+	})
+}
+
+func TestNaturalPerson(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("natural person CSR", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Jane Doe", roles, qcstatements.QWACType, WithSubjectType(NaturalPerson), WithGivenName("Jane"), WithSurname("Doe"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.Organization, ShouldBeEmpty)
+		var types []string
+		for _, name := range csr.Subject.Names {
+			types = append(types, name.Type.String())
+		}
+		So(types, ShouldResemble, []string{"2.5.4.6", "2.5.4.42", "2.5.4.4", "2.5.4.97", "2.5.4.3"})
+		So(nameAttribute(&csr.Subject, oidGivenName), ShouldEqual, "Jane")
+		So(nameAttribute(&csr.Subject, oidSurname), ShouldEqual, "Doe")
+	})
+
+	Convey("natural person QSEAL", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Jane Doe", roles, qcstatements.QSEALType, WithSubjectType(NaturalPerson))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("given name for a legal person", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, WithGivenName("Jane"), WithDNSName("example.com"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCommonNameLength(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	long := strings.Repeat("ä", 65)
+
+	Convey("64 character common name", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", long[:128], roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+	})
+
+	Convey("over-length common name", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", long, roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(errors.Is(err, ErrCommonNameTooLong), ShouldBeTrue)
+		So(data, ShouldBeNil)
+	})
+
+	Convey("over-length common name truncated", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", long, roles, qcstatements.QWACType, WithCommonNameTruncation(), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.CommonName, ShouldEqual, strings.Repeat("ä", 64))
+	})
+}
+
+func TestAdditionalQCType(t *testing.T) {
+	Convey("CSR with eseal and esign types", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithAdditionalQCType(qcstatements.QESIGNType))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		types, err := qcstatements.ExtractTypes(findQCStatements(csr.Extensions))
+		So(err, ShouldBeNil)
+		So(types, ShouldResemble, []asn1.ObjectIdentifier{qcstatements.QSEALType, qcstatements.QESIGNType})
+	})
+
+	Convey("multi-type CSR round trip", t, func() {
+		roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+		opts := []CertificateOption{WithAdditionalQCType(qcstatements.QESIGNType)}
+		data, key, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, opts...)
+		So(err, ShouldBeNil)
+		So(LintCSR(data), ShouldBeEmpty)
+
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		info, err := InfoFromCSR(csr)
+		So(err, ShouldBeNil)
+		So(info.Type, ShouldResemble, qcstatements.QSEALType)
+		So(info.Types, ShouldResemble, []asn1.ObjectIdentifier{qcstatements.QSEALType, qcstatements.QESIGNType})
+
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, key, opts...)
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(IsQSEAL(cert), ShouldBeTrue)
+		So(IsQWAC(cert), ShouldBeFalse)
+		So(ValidateConsistency(cert), ShouldBeNil)
+		roots := x509.NewCertPool()
+		roots.AddCert(cert)
+		So(VerifyAgainstRoots(cert, roots, nil), ShouldBeNil)
+
+		diffs, err := CompareQCStatements(data, der)
+		So(err, ShouldBeNil)
+		So(diffs, ShouldBeEmpty)
+	})
+}
+
+func TestRawSubjectPublicKeyInfo(t *testing.T) {
+	Convey("CSR with a pre-encoded public key", t, func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		spki, err := x509.MarshalPKIXPublicKey(key.Public())
+		So(err, ShouldBeNil)
+
+		data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, key, WithRawSubjectPublicKeyInfo(spki))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.RawSubjectPublicKeyInfo, ShouldResemble, spki)
+		So(csr.CheckSignature(), ShouldBeNil)
+	})
+
+	Convey("CSR with a public key which isn't the signer's", t, func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+		spki, err := x509.MarshalPKIXPublicKey(other.Public())
+		So(err, ShouldBeNil)
+
+		_, err = GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, key, WithRawSubjectPublicKeyInfo(spki))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("CSR with an invalid public key", t, func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		So(err, ShouldBeNil)
+
+		_, err = GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, key, WithRawSubjectPublicKeyInfo([]byte{0x30, 0x00}))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestNilSigner(t *testing.T) {
+	Convey("CSR with a nil signer", t, func() {
+		_, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, nil)
+		So(errors.Is(err, ErrNilSigner), ShouldBeTrue)
+	})
+
+	Convey("Self-signed certificate with a nil signer", t, func() {
+		_, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, nil)
+		So(errors.Is(err, ErrNilSigner), ShouldBeTrue)
+	})
+}
+
+func TestSANValidation(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("QWAC without DNS names", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType)
+		So(err, ShouldEqual, ErrMissingDNSName)
+	})
+
+	Convey("QWAC with only a directory name", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDirectoryNameSAN(pkix.Name{CommonName: "Foo"}))
+		So(err, ShouldEqual, ErrMissingDNSName)
+	})
+
+	Convey("QSEAL with a DNS name", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithDNSName("example.com"))
+		So(err, ShouldEqual, ErrUnexpectedSAN)
+	})
+
+	Convey("QSEAL with a directory name", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithDirectoryNameSAN(pkix.Name{CommonName: "Foo"}))
+		So(err, ShouldEqual, ErrUnexpectedSAN)
+	})
+
+	Convey("validation disabled", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithSANValidation(false))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.DNSNames, ShouldBeEmpty)
+
+		data, _, err = GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithDNSName("example.com"), WithSANValidation(false))
+		So(err, ShouldBeNil)
+		csr, err = x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.DNSNames, ShouldResemble, []string{"example.com"})
+	})
+}
+
+func TestExtensionOrder(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	extensionIDs := func(data []byte) []asn1.ObjectIdentifier {
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		var ids []asn1.ObjectIdentifier
+		for _, ext := range csr.Extensions {
+			ids = append(ids, ext.Id)
+		}
+		return ids
+	}
+
+	Convey("default order", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(extensionIDs(data), ShouldResemble, []asn1.ObjectIdentifier{oidExtensionSubjectAltName, oidExtensionKeyUsage, oidExtensionExtendedKeyUsage, oidExtensionSubjectKeyID, QCStatementsExt})
+	})
+
+	Convey("custom order", t, func() {
+		order := []asn1.ObjectIdentifier{QCStatementsExt, oidExtensionSubjectKeyID, oidExtensionKeyUsage, oidExtensionExtendedKeyUsage, oidExtensionSubjectAltName}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"), WithExtensionOrder(order))
+		So(err, ShouldBeNil)
+		So(extensionIDs(data), ShouldResemble, order)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.DNSNames, ShouldResemble, []string{"example.com"})
+	})
+
+	Convey("order listing absent extensions", t, func() {
+		order := []asn1.ObjectIdentifier{QCStatementsExt, oidExtensionSubjectAltName, oidExtensionExtendedKeyUsage, oidExtensionKeyUsage, oidExtensionSubjectKeyID}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithExtensionOrder(order))
+		So(err, ShouldBeNil)
+		So(extensionIDs(data), ShouldResemble, []asn1.ObjectIdentifier{QCStatementsExt, oidExtensionKeyUsage, oidExtensionSubjectKeyID})
+	})
+
+	Convey("order missing an extension", t, func() {
+		order := []asn1.ObjectIdentifier{QCStatementsExt, oidExtensionKeyUsage}
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithExtensionOrder(order))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+// subjectAttributeTag returns the ASN.1 tag of the first subject attribute
+// of the given type in a DER encoded CSR, or -1 if there is none.
+func subjectAttributeTag(data []byte, oid asn1.ObjectIdentifier) int {
+	csr, err := x509.ParseCertificateRequest(data)
+	So(err, ShouldBeNil)
+	// encoding/asn1 decodes slice types named *SET as a SET OF.
+	type attributeSET []struct {
+		Type  asn1.ObjectIdentifier
+		Value asn1.RawValue
+	}
+	var rdns []attributeSET
+	_, err = asn1.Unmarshal(csr.RawSubject, &rdns)
+	So(err, ShouldBeNil)
+	for _, rdn := range rdns {
+		for _, atv := range rdn {
+			if atv.Type.Equal(oid) {
+				return atv.Value.Tag
+			}
+		}
+	}
+	return -1
+}
+
+func TestOrgIDStringType(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	orgIDTag := func(data []byte) int {
+		return subjectAttributeTag(data, oidOrganizationID)
+	}
+
+	Convey("default string type", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType)
+		So(err, ShouldBeNil)
+		So(orgIDTag(data), ShouldEqual, asn1.TagPrintableString)
+	})
+
+	Convey("UTF8String", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithOrgIDStringType(asn1.TagUTF8String))
+		So(err, ShouldBeNil)
+		So(orgIDTag(data), ShouldEqual, asn1.TagUTF8String)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(nameAttribute(&csr.Subject, oidOrganizationID), ShouldEqual, "PSDGB-FCA-123456")
+	})
+
+	Convey("PrintableString", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithOrgIDStringType(asn1.TagPrintableString))
+		So(err, ShouldBeNil)
+		So(orgIDTag(data), ShouldEqual, asn1.TagPrintableString)
+	})
+
+	Convey("PrintableString with invalid characters", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456_*", "Foo Name", roles, qcstatements.QSEALType, WithOrgIDStringType(asn1.TagPrintableString))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("unsupported string type", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithOrgIDStringType(asn1.TagIA5String))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestUnknownQCType(t *testing.T) {
+	Convey("CSR with a bogus QcType", t, func() {
+		bogus := asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 9}
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, bogus)
+		So(err, ShouldBeError, "eidas: unsupported QC type 0.4.0.1862.1.6.9: must be qcstatements.QWACType (0.4.0.1862.1.6.3) or qcstatements.QSEALType (0.4.0.1862.1.6.2)")
+	})
+}
+
+func TestOBSoftwareStatementID(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	extID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+	Convey("CSR with software statement ID", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithOBSoftwareStatementID(extID, "2cfNF8Ct4SeLbvXhIV5Sk"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		var id string
+		found := false
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(extID) {
+				found = true
+				So(ext.Critical, ShouldBeFalse)
+				So(ext.Value[0], ShouldEqual, asn1.TagUTF8String)
+				_, err := asn1.Unmarshal(ext.Value, &id)
+				So(err, ShouldBeNil)
+			}
+		}
+		So(found, ShouldBeTrue)
+		So(id, ShouldEqual, "2cfNF8Ct4SeLbvXhIV5Sk")
+	})
+
+	Convey("CSR with software statement ID but no extension ID", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithOBSoftwareStatementID(nil, "2cfNF8Ct4SeLbvXhIV5Sk"))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRequestedValidity(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	extID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+
+	Convey("CSR with requested validity", t, func() {
+		notAfter := time.Date(2051, 6, 30, 12, 0, 0, 500, time.FixedZone("CEST", 2*60*60))
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithRequestedValidity(extID, notAfter))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		var value []byte
+		for _, ext := range csr.Extensions {
+			if ext.Id.Equal(extID) {
+				So(ext.Critical, ShouldBeFalse)
+				value = ext.Value
+			}
+		}
+		So(string(value), ShouldEqual, "\x18\x0f20510630100000Z")
+		var got time.Time
+		_, err = asn1.UnmarshalWithParams(value, &got, "generalized")
+		So(err, ShouldBeNil)
+		So(got.Equal(notAfter.Truncate(time.Second)), ShouldBeTrue)
+	})
+
+	Convey("CSR with requested validity but no extension ID", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithRequestedValidity(nil, time.Now()))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCommonNameStringType(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("default string type", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType)
+		So(err, ShouldBeNil)
+		So(subjectAttributeTag(data, oidCommonName), ShouldEqual, asn1.TagPrintableString)
+	})
+
+	Convey("UTF8String", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithCommonNameStringType(asn1.TagUTF8String))
+		So(err, ShouldBeNil)
+		So(subjectAttributeTag(data, oidCommonName), ShouldEqual, asn1.TagUTF8String)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.CommonName, ShouldEqual, "Foo Name")
+	})
+
+	Convey("PrintableString", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithCommonNameStringType(asn1.TagPrintableString))
+		So(err, ShouldBeNil)
+		So(subjectAttributeTag(data, oidCommonName), ShouldEqual, asn1.TagPrintableString)
+	})
+
+	Convey("PrintableString with invalid characters", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo_Name", roles, qcstatements.QSEALType, WithCommonNameStringType(asn1.TagPrintableString))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("unsupported string type", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithCommonNameStringType(asn1.TagIA5String))
+		So(err, ShouldBeError, "eidas: unsupported common name string type: 22")
+	})
+}
+
+func TestLegacyOrgIDLocation(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("CSR with the organization identifier in serialNumber", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithLegacyOrgIDLocation())
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Subject.SerialNumber, ShouldEqual, "PSDGB-FCA-123456")
+		So(nameAttribute(&csr.Subject, oidOrganizationID), ShouldBeEmpty)
+
+		names := csr.Subject.Names
+		So(names, ShouldHaveLength, 4)
+		So(names[2].Type, ShouldEqual, oidSerialNumber)
+		So(names[3].Type, ShouldEqual, oidCommonName)
+	})
+
+	Convey("legacy location with subject serial number", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithLegacyOrgIDLocation(), WithSubjectSerialNumber("12345678"))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "WithLegacyOrgIDLocation can't be combined with WithSubjectSerialNumber")
+	})
 }
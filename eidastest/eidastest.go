@@ -0,0 +1,110 @@
+// Package eidastest provides helpers for generating deliberately
+// non-compliant eIDAS CSRs, e.g. for negative testing of verifiers. The CSRs
+// are built with the eidas generators and then altered, bypassing their
+// validation. They must never be submitted to a CA.
+package eidastest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+
+	"github.com/apple/eidas"
+	"github.com/apple/eidas/internal/pkcs10"
+	"github.com/apple/eidas/qcstatements"
+)
+
+// CSRWithoutQCStatements builds a CSR like eidas.GenerateCSRWithKey but
+// without the qcStatements extension.
+func CSRWithoutQCStatements(
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, opts ...eidas.CertificateOption) ([]byte, error) {
+	csr, err := eidas.GenerateCSRWithKey(countryCode, orgName, orgID, commonName, roles, qcType, priv, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return replaceQCStatements(csr, priv, func([]byte) []byte { return nil })
+}
+
+// CSRWithCorruptRoles builds a CSR like eidas.GenerateCSRWithKey but with the
+// name of every role in the PSD2 statement replaced by the unknown role
+// "PSP_XX". The qcStatements extension remains valid DER.
+func CSRWithCorruptRoles(
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, opts ...eidas.CertificateOption) ([]byte, error) {
+	csr, err := eidas.GenerateCSRWithKey(countryCode, orgName, orgID, commonName, roles, qcType, priv, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return replaceQCStatements(csr, priv, func(qc []byte) []byte {
+		for _, role := range roles {
+			// Role names are the same length, so the DER lengths stay valid.
+			qc = bytes.ReplaceAll(qc, []byte(role), []byte("PSP_XX"))
+		}
+		return qc
+	})
+}
+
+// CSRWithMalformedQCStatements builds a CSR like eidas.GenerateCSRWithKey but
+// with the qcStatements extension value truncated, so it isn't valid DER.
+func CSRWithMalformedQCStatements(
+	countryCode string, orgName string, orgID string, commonName string, roles []qcstatements.Role, qcType asn1.ObjectIdentifier, priv crypto.Signer, opts ...eidas.CertificateOption) ([]byte, error) {
+	csr, err := eidas.GenerateCSRWithKey(countryCode, orgName, orgID, commonName, roles, qcType, priv, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return replaceQCStatements(csr, priv, func(qc []byte) []byte {
+		return qc[:len(qc)/2]
+	})
+}
+
+// replaceQCStatements signs a copy of a DER encoded CSR with the value of its
+// qcStatements extension replaced by edit, or removed if edit returns nil.
+// The version and all other attributes and extensions are kept as they are.
+func replaceQCStatements(der []byte, priv crypto.Signer, edit func([]byte) []byte) ([]byte, error) {
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csr: %v", err)
+	}
+
+	var editErr error
+	out, err := pkcs10.Resign(rand.Reader, der, csr.SignatureAlgorithm, priv, func(tbs *pkcs10.TBSCertificateRequest) {
+		for i, raw := range tbs.RawAttributes {
+			var attr pkcs10.Attribute
+			if _, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil {
+				editErr = err
+				return
+			}
+			if !attr.Type.Equal(pkcs10.OIDExtensionRequest) || len(attr.Values) != 1 {
+				continue
+			}
+			var extensions []pkix.Extension
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &extensions); err != nil {
+				editErr = err
+				return
+			}
+			var edited []pkix.Extension
+			for _, ext := range extensions {
+				if ext.Id.Equal(eidas.QCStatementsExt) {
+					value := edit(append([]byte(nil), ext.Value...))
+					if value == nil {
+						continue
+					}
+					ext.Value = value
+				}
+				edited = append(edited, ext)
+			}
+			tbs.RawAttributes[i], editErr = pkcs10.ExtensionRequestAttribute(edited)
+			return
+		}
+	})
+	if err == nil {
+		err = editErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate csr: %v", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,107 @@
+package eidastest
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/apple/eidas"
+	"github.com/apple/eidas/internal/pkcs10"
+	"github.com/apple/eidas/qcstatements"
+)
+
+var roles = []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation}
+
+func parse(t *testing.T, der []byte, err error) *x509.CertificateRequest {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("Expected valid signature but got %v", err)
+	}
+	return csr
+}
+
+func TestCSRWithoutQCStatements(t *testing.T) {
+	key, err := eidas.GenerateKey(eidas.ECP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := CSRWithoutQCStatements("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, key, eidas.WithDNSName("example.com"))
+	csr := parse(t, der, err)
+	if _, err := eidas.RolesFromCSR(csr); err != eidas.ErrNoQCStatements {
+		t.Errorf("Expected error: %v but got %v", eidas.ErrNoQCStatements, err)
+	}
+	if csr.Subject.CommonName != "Foo Name" {
+		t.Errorf("Expected common name: Foo Name but got %s", csr.Subject.CommonName)
+	}
+}
+
+func TestCSRWithCorruptRoles(t *testing.T) {
+	key, err := eidas.GenerateKey(eidas.ECP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := CSRWithCorruptRoles("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, key, eidas.WithDNSName("example.com"))
+	csr := parse(t, der, err)
+	got, err := eidas.RolesFromCSR(csr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(roles) {
+		t.Fatalf("Expected %d roles but got %v", len(roles), got)
+	}
+	for _, role := range got {
+		if _, err := qcstatements.RoleFromString(string(role)); err == nil {
+			t.Errorf("Expected unknown role but got %s", role)
+		}
+	}
+}
+
+func TestCSRWithMalformedQCStatements(t *testing.T) {
+	key, err := eidas.GenerateKey(eidas.ECP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := CSRWithMalformedQCStatements("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, key, eidas.WithDNSName("example.com"))
+	csr := parse(t, der, err)
+	if _, err := eidas.RolesFromCSR(csr); err == nil || err == eidas.ErrNoQCStatements {
+		t.Errorf("Expected decoding error but got %v", err)
+	}
+}
+
+func TestReplaceQCStatementsKeepsAttributes(t *testing.T) {
+	key, err := eidas.GenerateKey(eidas.ECP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := CSRWithCorruptRoles("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, key, eidas.WithDNSName("example.com"), eidas.WithChallengePassword("secret"), eidas.WithCSRVersion(1))
+	csr := parse(t, der, err)
+	var tbs pkcs10.TBSCertificateRequest
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		t.Fatal(err)
+	}
+	if tbs.Version != 1 {
+		t.Errorf("Expected version: 1 but got %d", tbs.Version)
+	}
+	var types []asn1.ObjectIdentifier
+	for _, raw := range tbs.RawAttributes {
+		var attr pkcs10.Attribute
+		if _, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, attr.Type)
+	}
+	// Attributes are DER sorted, and the challengePassword is the shorter.
+	if len(types) != 2 || !types[0].Equal(pkcs10.OIDChallengePassword) || !types[1].Equal(pkcs10.OIDExtensionRequest) {
+		t.Errorf("Expected extensionRequest and challengePassword attributes but got %v", types)
+	}
+	if len(csr.DNSNames) != 1 || csr.DNSNames[0] != "example.com" {
+		t.Errorf("Expected DNS names: [example.com] but got %v", csr.DNSNames)
+	}
+}
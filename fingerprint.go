@@ -0,0 +1,26 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+)
+
+// CSRFingerprint returns the hex encoded SHA-256 digest of a DER encoded CSR.
+func CSRFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// PublicKeyFingerprint returns the hex encoded SHA-256 digest of the
+// DER encoded SubjectPublicKeyInfo of the given public key.
+func PublicKeyFingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
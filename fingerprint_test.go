@@ -0,0 +1,29 @@
+package eidas
+
+import (
+	"crypto/rsa"
+	"math/big"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFingerprints(t *testing.T) {
+	Convey("CSR fingerprint", t, func() {
+		So(CSRFingerprint([]byte("abc")), ShouldEqual, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+	})
+
+	Convey("public key fingerprint", t, func() {
+		n, _ := new(big.Int).SetString("c"+strings.Repeat("3", 255), 16)
+		fp, err := PublicKeyFingerprint(&rsa.PublicKey{N: n, E: 65537})
+		So(err, ShouldBeNil)
+		So(fp, ShouldEqual, "4c6273d091a247a87e938a29abf9cb5f7659ee0519cf05318da058769a9eb10f")
+	})
+
+	Convey("unsupported public key", t, func() {
+		fp, err := PublicKeyFingerprint("not a key")
+		So(err, ShouldNotBeNil)
+		So(fp, ShouldBeEmpty)
+	})
+}
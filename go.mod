@@ -4,10 +4,15 @@ go 1.22.0
 
 toolchain go1.22.3
 
-require github.com/smartystreets/goconvey v1.8.1
+require (
+	github.com/smartystreets/goconvey v1.8.1
+	golang.org/x/net v0.35.0
+	gopkg.in/yaml.v2 v2.4.0
+)
 
 require (
 	github.com/gopherjs/gopherjs v1.17.2 // indirect
 	github.com/jtolds/gls v4.20.0+incompatible // indirect
 	github.com/smarty/assertions v1.15.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
 )
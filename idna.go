@@ -0,0 +1,26 @@
+package eidas
+
+import (
+	"fmt"
+
+	"golang.org/x/net/idna"
+)
+
+// WithIDNName adds the given internationalized domain as a Subject Alternate
+// Name to the CSR, converted to its A-label (punycode) form with the IDNA2008
+// lookup profile of UTS #46, e.g. "Bücher.example" becomes
+// "xn--bcher-kva.example".
+func WithIDNName(domain string) CertificateOption {
+	return func(o *certificateOptions) {
+		name, err := idna.Lookup.ToASCII(domain)
+		if err != nil {
+			o.err = fmt.Errorf("invalid hostname: %v", err)
+			return
+		}
+		if err := validateHostname(name); err != nil {
+			o.err = err
+			return
+		}
+		o.dnsNames = append(o.dnsNames, name)
+	}
+}
@@ -0,0 +1,46 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIDNName(t *testing.T) {
+	Convey("CSR with internationalized DNS name", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithIDNName("bücher.example"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.DNSNames, ShouldResemble, []string{"xn--bcher-kva.example"})
+	})
+
+	for _, tc := range []struct {
+		In       string
+		Expected string
+	}{
+		{"example.com", "example.com"},
+		{"München.de", "xn--mnchen-3ya.de"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		// UTS #46 maps fullwidth characters to their ASCII forms.
+		{"ｅｘａｍｐｌｅ.com", "example.com"},
+	} {
+		Convey("A-label for "+tc.In, t, func() {
+			data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithIDNName(tc.In))
+			So(err, ShouldBeNil)
+			csr, err := x509.ParseCertificateRequest(data)
+			So(err, ShouldBeNil)
+			So(csr.DNSNames, ShouldResemble, []string{tc.Expected})
+		})
+	}
+
+	Convey("invalid internationalized DNS name", t, func() {
+		for _, name := range []string{"bücher..example", "xn--ab.example", "a\u05d0.example"} {
+			data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithIDNName(name))
+			So(err, ShouldNotBeNil)
+			So(data, ShouldBeNil)
+		}
+	})
+}
@@ -0,0 +1,251 @@
+// Package pkcs10 encodes and signs PKCS#10 certificate requests (RFC 2986)
+// with control over the attributes, public key encoding and version, which
+// crypto/x509 doesn't offer.
+package pkcs10
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// CertificateRequest is the outer PKCS#10 CertificationRequest structure.
+// See RFC 2986 Section 4.
+type CertificateRequest struct {
+	Raw                asn1.RawContent
+	TBSCSR             TBSCertificateRequest
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+// TBSCertificateRequest is the PKCS#10 CertificationRequestInfo structure.
+type TBSCertificateRequest struct {
+	Raw           asn1.RawContent
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+// Attribute is a PKCS#10 attribute with a set of raw values.
+type Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// PKCS#9 attribute types from RFC 2985.
+var (
+	OIDChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+	OIDExtensionRequest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 14}
+)
+
+// ExtensionRequestAttribute returns a PKCS#9 extensionRequest attribute
+// carrying the given extensions, which may be empty.
+func ExtensionRequestAttribute(extensions []pkix.Extension) (asn1.RawValue, error) {
+	if extensions == nil {
+		extensions = []pkix.Extension{}
+	}
+	v, err := asn1.Marshal(extensions)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	d, err := asn1.Marshal(Attribute{
+		Type:   OIDExtensionRequest,
+		Values: []asn1.RawValue{{FullBytes: v}},
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: d}, nil
+}
+
+// ChallengePasswordAttribute returns a PKCS#9 challengePassword attribute.
+func ChallengePasswordAttribute(password string) (asn1.RawValue, error) {
+	// DirectoryString; encoding/asn1 picks PrintableString where possible and
+	// falls back to UTF8String.
+	v, err := asn1.Marshal(password)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	d, err := asn1.Marshal(Attribute{
+		Type:   OIDChallengePassword,
+		Values: []asn1.RawValue{{FullBytes: v}},
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: d}, nil
+}
+
+// Signature algorithm identifiers from RFC 4055, RFC 5758 and RFC 8410.
+var (
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidRSASSAPSS       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+	oidMGF1            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidEd25519         = asn1.ObjectIdentifier{1, 3, 101, 112}
+)
+
+var signatureAlgorithmDetails = map[x509.SignatureAlgorithm]struct {
+	oid        asn1.ObjectIdentifier
+	pubKeyAlgo x509.PublicKeyAlgorithm
+	hash       crypto.Hash
+	// hashOID is the digest algorithm in RSASSA-PSS parameters.
+	hashOID asn1.ObjectIdentifier
+	isPSS   bool
+}{
+	x509.SHA256WithRSA:    {oidSHA256WithRSA, x509.RSA, crypto.SHA256, nil, false},
+	x509.SHA384WithRSA:    {oidSHA384WithRSA, x509.RSA, crypto.SHA384, nil, false},
+	x509.SHA512WithRSA:    {oidSHA512WithRSA, x509.RSA, crypto.SHA512, nil, false},
+	x509.SHA256WithRSAPSS: {oidRSASSAPSS, x509.RSA, crypto.SHA256, oidSHA256, true},
+	x509.SHA384WithRSAPSS: {oidRSASSAPSS, x509.RSA, crypto.SHA384, oidSHA384, true},
+	x509.SHA512WithRSAPSS: {oidRSASSAPSS, x509.RSA, crypto.SHA512, oidSHA512, true},
+	x509.ECDSAWithSHA256:  {oidECDSAWithSHA256, x509.ECDSA, crypto.SHA256, nil, false},
+	x509.ECDSAWithSHA384:  {oidECDSAWithSHA384, x509.ECDSA, crypto.SHA384, nil, false},
+	x509.ECDSAWithSHA512:  {oidECDSAWithSHA512, x509.ECDSA, crypto.SHA512, nil, false},
+	// Ed25519 signs the message directly rather than a digest.
+	x509.PureEd25519: {oidEd25519, x509.Ed25519, crypto.Hash(0), nil, false},
+}
+
+// pssParameters is the RSASSA-PSS-params structure from RFC 4055 Section 3.1.
+type pssParameters struct {
+	Hash         pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF          pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength   int                      `asn1:"explicit,tag:2"`
+	TrailerField int                      `asn1:"optional,explicit,tag:3,default:1"`
+}
+
+// signatureAlgorithmIdentifier returns the AlgorithmIdentifier of alg as
+// encoded by crypto/x509: RSA PKCS#1 v1.5 has NULL parameters, RSASSA-PSS uses
+// MGF1 with the same hash and a salt as long as the hash, and ECDSA and
+// Ed25519 have none.
+func signatureAlgorithmIdentifier(alg x509.SignatureAlgorithm) (pkix.AlgorithmIdentifier, error) {
+	details, ok := signatureAlgorithmDetails[alg]
+	if !ok {
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported signature algorithm: %v", alg)
+	}
+	id := pkix.AlgorithmIdentifier{Algorithm: details.oid}
+	switch {
+	case details.isPSS:
+		hash := pkix.AlgorithmIdentifier{Algorithm: details.hashOID, Parameters: asn1.NullRawValue}
+		mgfHash, err := asn1.Marshal(hash)
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, err
+		}
+		params, err := asn1.Marshal(pssParameters{
+			Hash:         hash,
+			MGF:          pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfHash}},
+			SaltLength:   details.hash.Size(),
+			TrailerField: 1,
+		})
+		if err != nil {
+			return pkix.AlgorithmIdentifier{}, err
+		}
+		id.Parameters = asn1.RawValue{FullBytes: params}
+	case details.pubKeyAlgo == x509.RSA:
+		id.Parameters = asn1.NullRawValue
+	}
+	return id, nil
+}
+
+// CheckSignatureAlgorithm returns an error if alg is not supported or can't
+// be used with keys of the given algorithm.
+func CheckSignatureAlgorithm(alg x509.SignatureAlgorithm, pubKeyAlgo x509.PublicKeyAlgorithm) error {
+	details, ok := signatureAlgorithmDetails[alg]
+	if !ok {
+		return fmt.Errorf("unsupported signature algorithm: %v", alg)
+	}
+	if details.pubKeyAlgo != pubKeyAlgo {
+		return fmt.Errorf("signature algorithm %v can't be used with %v keys", alg, pubKeyAlgo)
+	}
+	return nil
+}
+
+// signerOptsForAlgorithm returns the options to pass to crypto.Signer.Sign
+// for the given signature algorithm.
+func signerOptsForAlgorithm(alg x509.SignatureAlgorithm) (crypto.SignerOpts, error) {
+	details, ok := signatureAlgorithmDetails[alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signature algorithm: %v", alg)
+	}
+	if details.isPSS {
+		return &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       details.hash,
+		}, nil
+	}
+	return details.hash, nil
+}
+
+// Sign encodes tbs, with its attributes sorted as DER requires for a SET OF,
+// and signs it with priv using alg.
+func Sign(rand io.Reader, tbs TBSCertificateRequest, alg x509.SignatureAlgorithm, priv crypto.Signer) ([]byte, error) {
+	algID, err := signatureAlgorithmIdentifier(alg)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := signerOptsForAlgorithm(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := make([]asn1.RawValue, len(tbs.RawAttributes))
+	copy(attrs, tbs.RawAttributes)
+	sort.Slice(attrs, func(i, j int) bool {
+		return bytes.Compare(attrs[i].FullBytes, attrs[j].FullBytes) < 0
+	})
+	tbs.RawAttributes = attrs
+	tbs.Raw = nil
+	tbsDER, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := tbsDER
+	if hash := opts.HashFunc(); hash != 0 {
+		h := hash.New()
+		h.Write(tbsDER)
+		signed = h.Sum(nil)
+	}
+	signature, err := priv.Sign(rand, signed, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(CertificateRequest{
+		TBSCSR:             TBSCertificateRequest{Raw: tbsDER},
+		SignatureAlgorithm: algID,
+		SignatureValue: asn1.BitString{
+			Bytes:     signature,
+			BitLength: len(signature) * 8,
+		},
+	})
+}
+
+// Resign decodes a DER encoded CSR, applies edit to its CertificationRequestInfo
+// and signs the result again with priv using alg.
+func Resign(rand io.Reader, der []byte, alg x509.SignatureAlgorithm, priv crypto.Signer, edit func(*TBSCertificateRequest)) ([]byte, error) {
+	var csr CertificateRequest
+	if rest, err := asn1.Unmarshal(der, &csr); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing data after certificate request")
+	}
+
+	tbs := csr.TBSCSR
+	edit(&tbs)
+	return Sign(rand, tbs, alg, priv)
+}
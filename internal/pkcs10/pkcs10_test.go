@@ -0,0 +1,134 @@
+package pkcs10
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+)
+
+func testKeys(t *testing.T) map[x509.PublicKeyAlgorithm]crypto.Signer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[x509.PublicKeyAlgorithm]crypto.Signer{
+		x509.RSA:     rsaKey,
+		x509.ECDSA:   ecKey,
+		x509.Ed25519: edKey,
+	}
+}
+
+func TestSignatureAlgorithmIdentifier(t *testing.T) {
+	keys := testKeys(t)
+	for alg, details := range signatureAlgorithmDetails {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:            pkix.Name{CommonName: "Foo Name"},
+			SignatureAlgorithm: alg,
+		}, keys[details.pubKeyAlgo])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var csr CertificateRequest
+		if _, err := asn1.Unmarshal(der, &csr); err != nil {
+			t.Fatal(err)
+		}
+		want, err := asn1.Marshal(csr.SignatureAlgorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := signatureAlgorithmIdentifier(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := asn1.Marshal(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v: Expected %x but got %x", alg, want, got)
+		}
+	}
+}
+
+func TestResign(t *testing.T) {
+	keys := testKeys(t)
+	// PKCS#1 v1.5 and Ed25519 signatures are deterministic, so an unedited
+	// CSR is re-signed to the same bytes.
+	for _, alg := range []x509.SignatureAlgorithm{x509.SHA256WithRSA, x509.SHA512WithRSA, x509.PureEd25519} {
+		priv := keys[signatureAlgorithmDetails[alg].pubKeyAlgo]
+		want, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject:            pkix.Name{CommonName: "Foo Name"},
+			DNSNames:           []string{"example.com"},
+			SignatureAlgorithm: alg,
+		}, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Resign(rand.Reader, want, alg, priv, func(*TBSCertificateRequest) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v: Expected %x but got %x", alg, want, got)
+		}
+	}
+}
+
+func TestSignSortsAttributes(t *testing.T) {
+	priv := testKeys(t)[x509.ECDSA]
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "Foo Name"},
+	}, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := ChallengePasswordAttribute("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	extensions, err := ExtensionRequestAttribute(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The empty extensionRequest attribute has the shorter encoding, so DER
+	// puts it before the challengePassword.
+	der, err = Resign(rand.Reader, der, x509.ECDSAWithSHA256, priv, func(tbs *TBSCertificateRequest) {
+		tbs.RawAttributes = []asn1.RawValue{password, extensions}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	var tbs TBSCertificateRequest
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		t.Fatal(err)
+	}
+	if len(tbs.RawAttributes) != 2 {
+		t.Fatalf("Expected 2 attributes but got %d", len(tbs.RawAttributes))
+	}
+	if !bytes.Equal(tbs.RawAttributes[0].FullBytes, extensions.FullBytes) {
+		t.Errorf("Expected extensionRequest first but got %x", tbs.RawAttributes[0].FullBytes)
+	}
+}
@@ -0,0 +1,130 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+)
+
+// KeyAlgorithm identifies the type and size of a generated key.
+type KeyAlgorithm int
+
+// Supported key algorithms.
+const (
+	RSA2048 KeyAlgorithm = iota
+	RSA4096
+	ECP256
+	Ed25519
+)
+
+// GenerateKey generates a key of the given algorithm using crypto/rand, e.g.
+// to pre-generate or pool keys for GenerateCSRWithKey.
+func GenerateKey(algo KeyAlgorithm) (crypto.Signer, error) {
+	return generateKey(algo, cryptorand.Reader)
+}
+
+func generateKey(algo KeyAlgorithm, rand io.Reader) (crypto.Signer, error) {
+	switch algo {
+	case RSA2048:
+		return rsa.GenerateKey(rand, 2048)
+	case RSA4096:
+		return rsa.GenerateKey(rand, 4096)
+	case ECP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand)
+	case Ed25519:
+		_, priv, err := ed25519.GenerateKey(rand)
+		if err != nil {
+			return nil, err
+		}
+		return priv, nil
+	}
+	return nil, fmt.Errorf("unknown key algorithm: %d", algo)
+}
+
+// KeyFormat is the encoding of a private key.
+type KeyFormat int
+
+// Supported private key formats.
+const (
+	// PKCS1 is the RSA-only format of RFC 8017 Appendix A.1.2.
+	PKCS1 KeyFormat = iota
+	// PKCS8 is the algorithm independent format of RFC 5208.
+	PKCS8
+)
+
+// EncodePrivateKey returns the DER encoding of key in the given format. PKCS1
+// is only supported for RSA keys.
+func EncodePrivateKey(key crypto.Signer, format KeyFormat) ([]byte, error) {
+	switch format {
+	case PKCS1:
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("PKCS#1 requires an RSA key but got %T", key)
+		}
+		return x509.MarshalPKCS1PrivateKey(rsaKey), nil
+	case PKCS8:
+		return x509.MarshalPKCS8PrivateKey(key)
+	}
+	return nil, fmt.Errorf("unknown key format: %d", format)
+}
+
+// publicKeyAlgorithm returns the x509.PublicKeyAlgorithm of a supported public key.
+func publicKeyAlgorithm(pub crypto.PublicKey) (x509.PublicKeyAlgorithm, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return x509.ECDSA, nil
+		}
+		return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("unsupported elliptic curve: %s", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return x509.Ed25519, nil
+	}
+	return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("unsupported key type: %T", pub)
+}
+
+// MeetsEIDASKeyStrength reports whether pub is at least as strong as eIDAS
+// compliance checks require, i.e. an RSA key of at least 2048 bits, an ECDSA
+// key on a curve of at least 256 bits such as P-256, or an Ed25519 key, which
+// ETSI TS 119 312 lists alongside them. The reason describes the key and, if
+// it falls short, why. The CSR and certificate generators reject keys that
+// fall short with ErrWeakKey.
+func MeetsEIDASKeyStrength(pub crypto.PublicKey) (bool, string) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		bits := pub.N.BitLen()
+		if bits < 2048 {
+			return false, fmt.Sprintf("RSA key is %d bits, at least 2048 are required", bits)
+		}
+		return true, fmt.Sprintf("RSA key is %d bits", bits)
+	case *ecdsa.PublicKey:
+		params := pub.Curve.Params()
+		if params.BitSize < 256 {
+			return false, fmt.Sprintf("ECDSA curve %s is %d bits, at least 256 are required", params.Name, params.BitSize)
+		}
+		return true, fmt.Sprintf("ECDSA curve %s is %d bits", params.Name, params.BitSize)
+	case ed25519.PublicKey:
+		return true, "Ed25519 key"
+	}
+	return false, fmt.Sprintf("%T is not an RSA, ECDSA or Ed25519 key", pub)
+}
+
+// defaultSignatureAlgorithm returns the signature algorithm used for keys of
+// the given type unless overridden with WithSignatureAlgorithm.
+func defaultSignatureAlgorithm(pubKeyAlgo x509.PublicKeyAlgorithm) x509.SignatureAlgorithm {
+	switch pubKeyAlgo {
+	case x509.ECDSA:
+		return x509.ECDSAWithSHA256
+	case x509.Ed25519:
+		return x509.PureEd25519
+	}
+	return x509.SHA256WithRSA
+}
@@ -0,0 +1,94 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncodePrivateKey(t *testing.T) {
+	Convey("RSA key as PKCS#1", t, func() {
+		key, err := GenerateKey(RSA2048)
+		So(err, ShouldBeNil)
+		der, err := EncodePrivateKey(key, PKCS1)
+		So(err, ShouldBeNil)
+		parsed, err := x509.ParsePKCS1PrivateKey(der)
+		So(err, ShouldBeNil)
+		So(parsed.Equal(key), ShouldBeTrue)
+	})
+
+	Convey("RSA key as PKCS#8", t, func() {
+		key, err := GenerateKey(RSA2048)
+		So(err, ShouldBeNil)
+		der, err := EncodePrivateKey(key, PKCS8)
+		So(err, ShouldBeNil)
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		So(err, ShouldBeNil)
+		So(parsed.(*rsa.PrivateKey).Equal(key), ShouldBeTrue)
+	})
+
+	Convey("ECDSA key as PKCS#8", t, func() {
+		key, err := GenerateKey(ECP256)
+		So(err, ShouldBeNil)
+		der, err := EncodePrivateKey(key, PKCS8)
+		So(err, ShouldBeNil)
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		So(err, ShouldBeNil)
+		So(parsed.(*ecdsa.PrivateKey).Equal(key), ShouldBeTrue)
+	})
+
+	Convey("non-RSA key as PKCS#1", t, func() {
+		key, err := GenerateKey(ECP256)
+		So(err, ShouldBeNil)
+		der, err := EncodePrivateKey(key, PKCS1)
+		So(err, ShouldNotBeNil)
+		So(der, ShouldBeNil)
+	})
+
+	Convey("unknown key format", t, func() {
+		key, err := GenerateKey(ECP256)
+		So(err, ShouldBeNil)
+		der, err := EncodePrivateKey(key, KeyFormat(-1))
+		So(err, ShouldNotBeNil)
+		So(der, ShouldBeNil)
+	})
+}
+
+func TestMeetsEIDASKeyStrength(t *testing.T) {
+	for _, tc := range []struct {
+		Name     string
+		Key      func() (crypto.Signer, error)
+		Expected bool
+	}{
+		{"RSA 1024", func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 1024) }, false},
+		{"RSA 2048", func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) }, true},
+		{"ECDSA P-224", func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P224(), rand.Reader) }, false},
+		{"ECDSA P-256", func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) }, true},
+		{"Ed25519", func() (crypto.Signer, error) {
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			return key, err
+		}, true},
+	} {
+		Convey(tc.Name, t, func() {
+			key, err := tc.Key()
+			So(err, ShouldBeNil)
+			ok, reason := MeetsEIDASKeyStrength(key.Public())
+			So(ok, ShouldEqual, tc.Expected)
+			So(reason, ShouldNotBeEmpty)
+		})
+	}
+
+	Convey("reason for a weak RSA key", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		So(err, ShouldBeNil)
+		_, reason := MeetsEIDASKeyStrength(key.Public())
+		So(reason, ShouldEqual, "RSA key is 1024 bits, at least 2048 are required")
+	})
+}
@@ -0,0 +1,122 @@
+package eidas
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"regexp"
+
+	"github.com/apple/eidas/qcstatements"
+)
+
+// WarningCode identifies the kind of issue reported by LintCSR.
+type WarningCode string
+
+// Warning codes reported by LintCSR.
+const (
+	WarnUnparseable        WarningCode = "unparseable"
+	WarnKeyStrength        WarningCode = "key-strength"
+	WarnKeyUsageMissing    WarningCode = "key-usage-missing"
+	WarnKeyUsageCritical   WarningCode = "key-usage-not-critical"
+	WarnSKIHash            WarningCode = "ski-not-sha1"
+	WarnCommonNameNotInSAN WarningCode = "cn-not-in-san"
+	WarnOrgIDMissing       WarningCode = "org-id-missing"
+	WarnOrgIDFormat        WarningCode = "org-id-format"
+	WarnQCStatements       WarningCode = "qc-statements"
+)
+
+// Warning is an issue found by LintCSR which is likely to cause a CA to reject
+// the CSR.
+type Warning struct {
+	Code    WarningCode
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Code, w.Message)
+}
+
+// orgIDPattern matches a PSD2 organization identifier, e.g. "PSDGB-FCA-123456".
+// See ETSI TS 119 495 Section 5.2.1.
+var orgIDPattern = regexp.MustCompile(`^PSD[A-Z]{2}-[A-Z]+-.+$`)
+
+// LintCSR checks a DER encoded CSR for issues which commonly cause CAs to
+// reject eIDAS CSRs. It returns no warnings for CSRs generated by this package
+// with default options and a PSD2 organization identifier, including those
+// following the Open Banking naming policy or using WithLegacyOrgIDLocation.
+func LintCSR(der []byte) []Warning {
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return []Warning{{WarnUnparseable, fmt.Sprintf("failed to parse csr: %v", err)}}
+	}
+
+	var warnings []Warning
+	warn := func(code WarningCode, format string, a ...interface{}) {
+		warnings = append(warnings, Warning{code, fmt.Sprintf(format, a...)})
+	}
+
+	if ok, reason := MeetsEIDASKeyStrength(csr.PublicKey); !ok {
+		warn(WarnKeyStrength, "%s", reason)
+	}
+
+	keyUsage := false
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			keyUsage = true
+			if !ext.Critical {
+				warn(WarnKeyUsageCritical, "keyUsage extension is not critical")
+			}
+		case ext.Id.Equal(oidExtensionSubjectKeyID):
+			expected, err := subjectKeyIdentifier(csr.PublicKey, crypto.SHA1)
+			if err == nil && !bytes.Equal(ext.Value, expected.Value) {
+				warn(WarnSKIHash, "subject key identifier is not the SHA-1 hash of the public key")
+			}
+		}
+	}
+	if !keyUsage {
+		warn(WarnKeyUsageMissing, "keyUsage extension is missing")
+	}
+
+	// Older NCA profiles put the organization identifier in serialNumber.
+	orgID := nameAttribute(&csr.Subject, oidOrganizationID)
+	if orgID == "" {
+		orgID = nameAttribute(&csr.Subject, oidSerialNumber)
+	}
+
+	// The Open Banking naming policy makes the common name the organization
+	// identifier, which can't be a DNS name.
+	cn := csr.Subject.CommonName
+	if len(csr.DNSNames) != 0 && cn != orgID && !containsString(csr.DNSNames, cn) {
+		warn(WarnCommonNameNotInSAN, "common name %q is not one of the DNS names %v", cn, csr.DNSNames)
+	}
+
+	if orgID == "" {
+		warn(WarnOrgIDMissing, "subject has no organizationIdentifier")
+	} else if !orgIDPattern.MatchString(orgID) {
+		warn(WarnOrgIDFormat, "organizationIdentifier %q is not of the form PSDXX-NCA-ID", orgID)
+	}
+
+	qc := findQCStatements(csr.Extensions)
+	if qc == nil {
+		warn(WarnQCStatements, "qcStatements extension is missing")
+		return warnings
+	}
+	if _, err := qcstatements.ExtractTypes(qc); err != nil {
+		warn(WarnQCStatements, "invalid QcType statement: %v", err)
+	}
+	if _, _, _, err := qcstatements.Extract(qc); err != nil {
+		warn(WarnQCStatements, "invalid PSD2 statement: %v", err)
+	}
+	return warnings
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
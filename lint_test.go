@@ -0,0 +1,124 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// warningCodes returns the codes of the given warnings.
+func warningCodes(warnings []Warning) []WarningCode {
+	var codes []WarningCode
+	for _, w := range warnings {
+		codes = append(codes, w.Code)
+	}
+	return codes
+}
+
+func TestLintCSR(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("default CSR has no warnings", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "foo.example.com", roles, qcstatements.QWACType, WithDNSName("foo.example.com"))
+		So(err, ShouldBeNil)
+		So(LintCSR(data), ShouldBeEmpty)
+	})
+
+	Convey("Open Banking QWAC has no warnings", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "PSDGB-FCA-123456", roles, qcstatements.QWACType, WithOBNamingPolicy(), WithDNSName("api.example.com"))
+		So(err, ShouldBeNil)
+		So(LintCSR(data), ShouldBeEmpty)
+	})
+
+	Convey("CSR with the organization identifier in serialNumber has no warnings", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithLegacyOrgIDLocation())
+		So(err, ShouldBeNil)
+		So(LintCSR(data), ShouldBeEmpty)
+
+		data, _, err = GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithLegacyOrgIDLocation())
+		So(err, ShouldBeNil)
+		So(warningCodes(LintCSR(data)), ShouldResemble, []WarningCode{WarnOrgIDFormat})
+	})
+
+	for _, tc := range []struct {
+		Name     string
+		OrgID    string
+		Opts     []CertificateOption
+		Expected WarningCode
+	}{
+		{"non-critical keyUsage", "PSDGB-FCA-123456", []CertificateOption{WithKeyUsageCritical(false)}, WarnKeyUsageCritical},
+		{"SHA-256 subject key identifier", "PSDGB-FCA-123456", []CertificateOption{WithSubjectKeyIdentifierHash(crypto.SHA256)}, WarnSKIHash},
+		{"common name not in SAN", "PSDGB-FCA-123456", []CertificateOption{WithDNSName("bar.example.com")}, WarnCommonNameNotInSAN},
+		{"non-PSD2 organization identifier", "Foo Org ID", nil, WarnOrgIDFormat},
+	} {
+		Convey(tc.Name, t, func() {
+			data, _, err := GenerateCSR("GB", "Foo Org", tc.OrgID, "Foo Name", roles, qcstatements.QWACType, append(tc.Opts, WithSANValidation(false))...)
+			So(err, ShouldBeNil)
+			So(warningCodes(LintCSR(data)), ShouldResemble, []WarningCode{tc.Expected})
+		})
+	}
+
+	Convey("CSR with a weak key", t, func() {
+		// The generators reject weak keys, so copy the subject and extensions
+		// of a generated CSR, except for the subject key identifier, into one
+		// signed with a 1024-bit key.
+		generated, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "foo.example.com", roles, qcstatements.QWACType, WithDNSName("foo.example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(generated)
+		So(err, ShouldBeNil)
+		var extensions []pkix.Extension
+		for _, ext := range csr.Extensions {
+			if !ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 14}) {
+				extensions = append(extensions, ext)
+			}
+		}
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		So(err, ShouldBeNil)
+		data, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			RawSubject:      csr.RawSubject,
+			ExtraExtensions: extensions,
+		}, key)
+		So(err, ShouldBeNil)
+		So(warningCodes(LintCSR(data)), ShouldResemble, []WarningCode{WarnKeyStrength})
+	})
+
+	Convey("CSR without eIDAS content", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		data, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "Foo Name"},
+		}, key)
+		So(err, ShouldBeNil)
+		So(warningCodes(LintCSR(data)), ShouldResemble, []WarningCode{WarnKeyUsageMissing, WarnOrgIDMissing, WarnQCStatements})
+	})
+
+	Convey("QCStatements without PSD2 statement", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		qc, err := qcstatements.SerializePSD2Only(roles, qcstatements.CompetentAuthority{Name: "Financial Conduct Authority", ID: "GB-FCA"})
+		So(err, ShouldBeNil)
+		// A sequence holding only the PSD2 statement, so without a QcType.
+		qc = append([]byte{0x30, byte(len(qc))}, qc...)
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		data, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			RawSubject:      csr.RawSubject,
+			ExtraExtensions: []pkix.Extension{keyUsageExtension([]x509.KeyUsage{x509.KeyUsageDigitalSignature}), qcStatementsExtension(qc, false)},
+		}, key)
+		So(err, ShouldBeNil)
+		So(warningCodes(LintCSR(data)), ShouldResemble, []WarningCode{WarnQCStatements})
+	})
+
+	Convey("malformed CSR", t, func() {
+		So(warningCodes(LintCSR([]byte{0x30, 0x00})), ShouldResemble, []WarningCode{WarnUnparseable})
+	})
+}
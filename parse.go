@@ -0,0 +1,318 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/apple/eidas/qcstatements"
+)
+
+// ErrNoQCStatements is returned when a CSR or certificate has no qcStatements extension.
+var ErrNoQCStatements = errors.New("eidas: no qcStatements extension found")
+
+// findQCStatements returns the value of the qcStatements extension, or nil if
+// it isn't present.
+func findQCStatements(exts []pkix.Extension) []byte {
+	for _, ext := range exts {
+		if ext.Id.Equal(QCStatementsExt) {
+			return ext.Value
+		}
+	}
+	return nil
+}
+
+// RolesFromCSR returns the PSD2 roles declared in the qcStatements extension
+// of a parsed CSR. It returns ErrNoQCStatements if the extension is missing.
+func RolesFromCSR(csr *x509.CertificateRequest) ([]qcstatements.Role, error) {
+	qc := findQCStatements(csr.Extensions)
+	if qc == nil {
+		return nil, ErrNoQCStatements
+	}
+	roles, _, _, err := qcstatements.Extract(qc)
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// RoleNamesFromCertificate returns the display names, e.g. "Account
+// Information", of the PSD2 roles declared in the qcStatements extension of a
+// parsed certificate. It returns ErrNoQCStatements if the extension is missing.
+func RoleNamesFromCertificate(cert *x509.Certificate) ([]string, error) {
+	info, err := InfoFromCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(info.Roles))
+	for i, role := range info.Roles {
+		names[i] = role.String()
+	}
+	return names, nil
+}
+
+// PublicKeyFromCSR returns the public key of a DER encoded CSR, e.g. for use
+// with PublicKeyFingerprint.
+func PublicKeyFromCSR(der []byte) (crypto.PublicKey, error) {
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse csr: %v", err)
+	}
+	return csr.PublicKey, nil
+}
+
+// EIDASInfo is the PSD2 information carried in the qcStatements extension of
+// a CSR or certificate.
+type EIDASInfo struct {
+	Roles []qcstatements.Role `json:"roles"`
+	// Type is the first QcType, e.g. qcstatements.QWACType, and Types lists
+	// every QcType in the order they are encoded.
+	Type   asn1.ObjectIdentifier   `json:"type"`
+	Types  []asn1.ObjectIdentifier `json:"types"`
+	CAName string                  `json:"caName"`
+	CAID   string                  `json:"caId"`
+	// KeyUsage and ExtendedKeyUsage are decoded from the keyUsage and
+	// extKeyUsage extensions. Unrecognized extended key usages are omitted.
+	KeyUsage         x509.KeyUsage      `json:"keyUsage"`
+	ExtendedKeyUsage []x509.ExtKeyUsage `json:"extendedKeyUsage"`
+}
+
+// keyUsageNames are the names of the key usage bits from RFC 5280 Section
+// 4.2.1.3, in bit order.
+var keyUsageNames = []string{
+	"digitalSignature",
+	"contentCommitment",
+	"keyEncipherment",
+	"dataEncipherment",
+	"keyAgreement",
+	"keyCertSign",
+	"cRLSign",
+	"encipherOnly",
+	"decipherOnly",
+}
+
+// extKeyUsages maps extended key usage OIDs to the x509.ExtKeyUsage values
+// and names reported in EIDASInfo.
+var extKeyUsages = []struct {
+	oid   asn1.ObjectIdentifier
+	usage x509.ExtKeyUsage
+	name  string
+}{
+	{asn1.ObjectIdentifier{2, 5, 29, 37, 0}, x509.ExtKeyUsageAny, "any"},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}, x509.ExtKeyUsageServerAuth, "serverAuth"},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}, x509.ExtKeyUsageClientAuth, "clientAuth"},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 3}, x509.ExtKeyUsageCodeSigning, "codeSigning"},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 4}, x509.ExtKeyUsageEmailProtection, "emailProtection"},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 8}, x509.ExtKeyUsageTimeStamping, "timeStamping"},
+	{asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 9}, x509.ExtKeyUsageOCSPSigning, "OCSPSigning"},
+}
+
+// MarshalJSON renders roles by name, e.g. "Account Information", the types as
+// "QWAC" or "QSEAL", falling back to the dotted OID for other types, and key
+// usages by their RFC 5280 names, e.g. "digitalSignature" and "serverAuth".
+func (i EIDASInfo) MarshalJSON() ([]byte, error) {
+	roles := make([]string, len(i.Roles))
+	for n, role := range i.Roles {
+		roles[n] = role.String()
+	}
+	types := make([]string, len(i.Types))
+	for n, t := range i.Types {
+		types[n] = qcTypeName(t)
+	}
+	keyUsage := []string{}
+	for bit, name := range keyUsageNames {
+		if i.KeyUsage&(1<<uint(bit)) != 0 {
+			keyUsage = append(keyUsage, name)
+		}
+	}
+	extKeyUsage := []string{}
+	for _, usage := range i.ExtendedKeyUsage {
+		for _, eku := range extKeyUsages {
+			if eku.usage == usage {
+				extKeyUsage = append(extKeyUsage, eku.name)
+			}
+		}
+	}
+	return json.Marshal(struct {
+		Roles            []string `json:"roles"`
+		Type             string   `json:"type"`
+		Types            []string `json:"types"`
+		CAName           string   `json:"caName"`
+		CAID             string   `json:"caId"`
+		KeyUsage         []string `json:"keyUsage"`
+		ExtendedKeyUsage []string `json:"extendedKeyUsage"`
+	}{roles, qcTypeName(i.Type), types, i.CAName, i.CAID, keyUsage, extKeyUsage})
+}
+
+// qcTypeName returns "QWAC" or "QSEAL" for those types and the dotted OID for
+// any other.
+func qcTypeName(t asn1.ObjectIdentifier) string {
+	switch {
+	case t.Equal(qcstatements.QWACType):
+		return "QWAC"
+	case t.Equal(qcstatements.QSEALType):
+		return "QSEAL"
+	}
+	return t.String()
+}
+
+// InfoFromCertificate returns the PSD2 information in the qcStatements
+// extension of a parsed certificate. It returns ErrNoQCStatements if the
+// extension is missing.
+func InfoFromCertificate(cert *x509.Certificate) (*EIDASInfo, error) {
+	return infoFromExtensions(cert.Extensions)
+}
+
+// InfoFromCSR returns the PSD2 information in the qcStatements extension of a
+// parsed CSR. It returns ErrNoQCStatements if the extension is missing.
+func InfoFromCSR(csr *x509.CertificateRequest) (*EIDASInfo, error) {
+	return infoFromExtensions(csr.Extensions)
+}
+
+// ExtractFromPEMFile reads the PEM encoded certificate at path and returns
+// the PSD2 information in its qcStatements extension. Only the first PEM
+// block is read and it must be a CERTIFICATE block.
+func ExtractFromPEMFile(path string) (*EIDASInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	der, err := CertFromPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	return InfoFromCertificate(cert)
+}
+
+func infoFromExtensions(exts []pkix.Extension) (*EIDASInfo, error) {
+	qc := findQCStatements(exts)
+	if qc == nil {
+		return nil, ErrNoQCStatements
+	}
+	roles, name, id, err := qcstatements.Extract(qc)
+	if err != nil {
+		return nil, err
+	}
+	types, err := qcstatements.ExtractTypes(qc)
+	if err != nil {
+		return nil, err
+	}
+	info := &EIDASInfo{
+		Roles:  roles,
+		Type:   types[0],
+		Types:  types,
+		CAName: name,
+		CAID:   id,
+	}
+	for _, ext := range exts {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			ku, err := ParseKeyUsage(ext)
+			if err != nil {
+				return nil, err
+			}
+			info.KeyUsage = ku
+		case ext.Id.Equal(oidExtensionExtendedKeyUsage):
+			var oids []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+				return nil, fmt.Errorf("failed to decode extended key usage: %v", err)
+			}
+			for _, oid := range oids {
+				for _, eku := range extKeyUsages {
+					if eku.oid.Equal(oid) {
+						info.ExtendedKeyUsage = append(info.ExtendedKeyUsage, eku.usage)
+					}
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// ParseKeyUsage decodes a keyUsage extension. Besides DER it accepts the
+// encoding this package historically emitted, a fixed two byte BIT STRING with
+// no unused bits and a trailing zero byte, as well as non-minimal encodings
+// and non-zero unused bits, which are ignored like bits beyond decipherOnly.
+func ParseKeyUsage(ext pkix.Extension) (x509.KeyUsage, error) {
+	if !ext.Id.Equal(oidExtensionKeyUsage) {
+		return 0, fmt.Errorf("eidas: not a keyUsage extension: %v", ext.Id)
+	}
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(ext.Value, &raw)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode key usage: %v", err)
+	}
+	if len(rest) != 0 {
+		return 0, fmt.Errorf("failed to decode key usage: %d trailing bytes", len(rest))
+	}
+	if raw.Class != asn1.ClassUniversal || raw.Tag != asn1.TagBitString || raw.IsCompound {
+		return 0, errors.New("failed to decode key usage: not a BIT STRING")
+	}
+	if len(raw.Bytes) == 0 || raw.Bytes[0] > 7 {
+		return 0, errors.New("failed to decode key usage: invalid BIT STRING")
+	}
+	// Bit n is the nth most significant bit of the content after the unused
+	// bits count.
+	bits := raw.Bytes[1:]
+	bitLength := len(bits)*8 - int(raw.Bytes[0])
+	var ku x509.KeyUsage
+	for bit := range keyUsageNames {
+		if bit < bitLength && bits[bit/8]&(0x80>>uint(bit%8)) != 0 {
+			ku |= 1 << uint(bit)
+		}
+	}
+	return ku, nil
+}
+
+// IsQWAC reports whether cert declares QWACType, and not QSEALType, among its
+// QcTypes. It returns false if the qcStatements extension is missing or can't
+// be parsed.
+func IsQWAC(cert *x509.Certificate) bool {
+	return hasQCType(cert, qcstatements.QWACType)
+}
+
+// IsQSEAL reports whether cert declares QSEALType, and not QWACType, among its
+// QcTypes. It returns false if the qcStatements extension is missing or can't
+// be parsed.
+func IsQSEAL(cert *x509.Certificate) bool {
+	return hasQCType(cert, qcstatements.QSEALType)
+}
+
+func hasQCType(cert *x509.Certificate, want asn1.ObjectIdentifier) bool {
+	qc := findQCStatements(cert.Extensions)
+	if qc == nil {
+		return false
+	}
+	types, err := qcstatements.ExtractTypes(qc)
+	if err != nil {
+		return false
+	}
+	t, err := psd2Type(types)
+	return err == nil && t.Equal(want)
+}
+
+// psd2Type returns which of QWACType and QSEALType is listed in types, which
+// may also list other types such as QESIGNType. It returns an error if both
+// or neither are listed.
+func psd2Type(types []asn1.ObjectIdentifier) (asn1.ObjectIdentifier, error) {
+	qwac := containsOID(types, qcstatements.QWACType)
+	qseal := containsOID(types, qcstatements.QSEALType)
+	switch {
+	case qwac && qseal:
+		return nil, errors.New("QC types include both QWAC and QSEAL")
+	case qwac:
+		return qcstatements.QWACType, nil
+	case qseal:
+		return qcstatements.QSEALType, nil
+	}
+	return nil, fmt.Errorf("unknown QC type: %v", types[0])
+}
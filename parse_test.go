@@ -0,0 +1,263 @@
+package eidas
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRolesFromCSR(t *testing.T) {
+	Convey("roles from generated CSR", t, func() {
+		roles := []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation}
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		got, err := RolesFromCSR(csr)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, roles)
+	})
+
+	Convey("CSR without qcStatements", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		data, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "Foo Name"},
+		}, key)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		roles, err := RolesFromCSR(csr)
+		So(err, ShouldEqual, ErrNoQCStatements)
+		So(roles, ShouldBeNil)
+	})
+}
+
+func TestInfoFromCertificate(t *testing.T) {
+	Convey("JSON for a parsed QWAC", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		roles := []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation}
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, key, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+
+		info, err := InfoFromCertificate(cert)
+		So(err, ShouldBeNil)
+		So(info.Roles, ShouldResemble, roles)
+		So(info.Type, ShouldResemble, qcstatements.QWACType)
+		So(info.KeyUsage, ShouldEqual, x509.KeyUsageDigitalSignature)
+		So(info.ExtendedKeyUsage, ShouldResemble, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+
+		data, err := json.Marshal(info)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldEqual, `{"roles":["Account Information","Payment Initiation"],"type":"QWAC","types":["QWAC"],"caName":"Financial Conduct Authority","caId":"GB-FCA","keyUsage":["digitalSignature"],"extendedKeyUsage":["serverAuth","clientAuth"]}`)
+	})
+
+	Convey("certificate with critical qcStatements", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		roles := []qcstatements.Role{qcstatements.RoleAccountServicing}
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, key, WithQCStatementsCritical(true))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(cert.UnhandledCriticalExtensions, ShouldResemble, []asn1.ObjectIdentifier{QCStatementsExt})
+
+		info, err := InfoFromCertificate(cert)
+		So(err, ShouldBeNil)
+		So(info.Roles, ShouldResemble, roles)
+		So(info.Type, ShouldResemble, qcstatements.QSEALType)
+		So(ValidateConsistency(cert), ShouldBeNil)
+	})
+
+	Convey("JSON for a QSEAL CSR", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountServicing}, qcstatements.QSEALType)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		info, err := InfoFromCSR(csr)
+		So(err, ShouldBeNil)
+		data, err = json.Marshal(info)
+		So(err, ShouldBeNil)
+		So(string(data), ShouldContainSubstring, `"type":"QSEAL"`)
+		So(string(data), ShouldContainSubstring, `"roles":["Account Servicing"]`)
+		So(info.KeyUsage, ShouldEqual, x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment)
+		So(string(data), ShouldContainSubstring, `"extendedKeyUsage":[]`)
+	})
+}
+
+func TestPublicKeyFromCSR(t *testing.T) {
+	Convey("public key matches the signing key", t, func() {
+		data, key, err := GenerateCSRWithAlgorithm(ECP256, "GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		pub, err := PublicKeyFromCSR(data)
+		So(err, ShouldBeNil)
+		So(key.Public().(*ecdsa.PublicKey).Equal(pub), ShouldBeTrue)
+
+		got, err := PublicKeyFingerprint(pub)
+		So(err, ShouldBeNil)
+		expected, err := PublicKeyFingerprint(key.Public())
+		So(err, ShouldBeNil)
+		So(got, ShouldEqual, expected)
+	})
+
+	Convey("malformed CSR", t, func() {
+		pub, err := PublicKeyFromCSR([]byte{0x30, 0x03, 0x02, 0x01})
+		So(err, ShouldNotBeNil)
+		So(pub, ShouldBeNil)
+	})
+}
+
+func TestRoleNamesFromCertificate(t *testing.T) {
+	Convey("role names from a multi-role certificate", t, func() {
+		key, err := GenerateKey(ECP256)
+		So(err, ShouldBeNil)
+		roles := []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation, qcstatements.RolePaymentInstruments}
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QWACType, key, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		names, err := RoleNamesFromCertificate(cert)
+		So(err, ShouldBeNil)
+		So(names, ShouldResemble, []string{"Account Information", "Payment Initiation", "Issuing of Card-Based Payment Instruments"})
+	})
+
+	Convey("certificate without qcStatements", t, func() {
+		names, err := RoleNamesFromCertificate(&x509.Certificate{})
+		So(err, ShouldEqual, ErrNoQCStatements)
+		So(names, ShouldBeNil)
+	})
+}
+
+func TestIsQWACAndIsQSEAL(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+	selfSigned := func(qcType asn1.ObjectIdentifier, opts ...CertificateOption) *x509.Certificate {
+		key, err := GenerateKey(ECP256)
+		So(err, ShouldBeNil)
+		der, err := GenerateSelfSignedCert("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcType, key, append(opts, WithSANValidation(false))...)
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		return cert
+	}
+
+	Convey("QWAC", t, func() {
+		cert := selfSigned(qcstatements.QWACType)
+		So(IsQWAC(cert), ShouldBeTrue)
+		So(IsQSEAL(cert), ShouldBeFalse)
+	})
+
+	Convey("QSEAL", t, func() {
+		cert := selfSigned(qcstatements.QSEALType)
+		So(IsQWAC(cert), ShouldBeFalse)
+		So(IsQSEAL(cert), ShouldBeTrue)
+	})
+
+	Convey("ambiguous QcType", t, func() {
+		cert := selfSigned(qcstatements.QSEALType, WithAdditionalQCType(qcstatements.QWACType))
+		So(IsQWAC(cert), ShouldBeFalse)
+		So(IsQSEAL(cert), ShouldBeFalse)
+	})
+
+	Convey("non-eIDAS certificate", t, func() {
+		root, _ := testCA("Root CA", nil, nil)
+		So(IsQWAC(root), ShouldBeFalse)
+		So(IsQSEAL(root), ShouldBeFalse)
+	})
+}
+
+func TestExtractFromPEMFile(t *testing.T) {
+	Convey("certificate fixture", t, func() {
+		info, err := ExtractFromPEMFile("testdata/qseal.pem")
+		So(err, ShouldBeNil)
+		So(info.Roles, ShouldResemble, []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation})
+		So(info.Type, ShouldResemble, qcstatements.QSEALType)
+		So(info.CAName, ShouldEqual, "Financial Conduct Authority")
+		So(info.CAID, ShouldEqual, "GB-FCA")
+	})
+
+	Convey("missing file", t, func() {
+		_, err := ExtractFromPEMFile("testdata/missing.pem")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("file without a certificate", t, func() {
+		path := filepath.Join(t.TempDir(), "csr.pem")
+		So(os.WriteFile(path, CSRToPEM([]byte{1, 2, 3}), 0644), ShouldBeNil)
+		_, err := ExtractFromPEMFile(path)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestParseKeyUsage(t *testing.T) {
+	keyUsage := func(value []byte) pkix.Extension {
+		return pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: value}
+	}
+
+	for _, tc := range []struct {
+		Name     string
+		Buggy    []byte
+		Correct  []byte
+		Expected x509.KeyUsage
+	}{
+		{"QWAC", []byte{0x03, 0x03, 0x00, 0x80, 0x00}, []byte{0x03, 0x02, 0x07, 0x80}, x509.KeyUsageDigitalSignature},
+		{"QSEAL", []byte{0x03, 0x03, 0x00, 0xc0, 0x00}, []byte{0x03, 0x02, 0x06, 0xc0}, x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment},
+	} {
+		Convey(tc.Name+" historical and DER layouts decode the same", t, func() {
+			buggy, err := ParseKeyUsage(keyUsage(tc.Buggy))
+			So(err, ShouldBeNil)
+			correct, err := ParseKeyUsage(keyUsage(tc.Correct))
+			So(err, ShouldBeNil)
+			So(buggy, ShouldEqual, tc.Expected)
+			So(correct, ShouldEqual, tc.Expected)
+		})
+	}
+
+	Convey("generated keyUsage extension", t, func() {
+		ext := keyUsageExtension([]x509.KeyUsage{x509.KeyUsageDigitalSignature, x509.KeyUsageDecipherOnly})
+		ku, err := ParseKeyUsage(ext)
+		So(err, ShouldBeNil)
+		So(ku, ShouldEqual, x509.KeyUsageDigitalSignature|x509.KeyUsageDecipherOnly)
+	})
+
+	Convey("non-zero unused bits are ignored", t, func() {
+		ku, err := ParseKeyUsage(keyUsage([]byte{0x03, 0x02, 0x07, 0x81}))
+		So(err, ShouldBeNil)
+		So(ku, ShouldEqual, x509.KeyUsageDigitalSignature)
+	})
+
+	Convey("empty BIT STRING", t, func() {
+		ku, err := ParseKeyUsage(keyUsage([]byte{0x03, 0x01, 0x00}))
+		So(err, ShouldBeNil)
+		So(ku, ShouldEqual, 0)
+	})
+
+	Convey("invalid encodings", t, func() {
+		for _, value := range [][]byte{
+			{0x04, 0x01, 0x80},
+			{0x03, 0x00},
+			{0x03, 0x02, 0x08, 0x80},
+			{0x03, 0x02, 0x07, 0x80, 0x00},
+		} {
+			_, err := ParseKeyUsage(keyUsage(value))
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("other extension", t, func() {
+		_, err := ParseKeyUsage(pkix.Extension{Id: oidExtensionSubjectKeyID, Value: []byte{0x04, 0x00}})
+		So(err, ShouldNotBeNil)
+	})
+}
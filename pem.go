@@ -0,0 +1,100 @@
+package eidas
+
+import (
+	"crypto"
+	"encoding/pem"
+	"fmt"
+)
+
+const (
+	pemTypeCSR         = "CERTIFICATE REQUEST"
+	pemTypeLegacyCSR   = "NEW CERTIFICATE REQUEST"
+	pemTypeCertificate = "CERTIFICATE"
+	pemTypePrivateKey  = "PRIVATE KEY"
+)
+
+// CSRToPEM encodes a DER encoded CSR as a PEM CERTIFICATE REQUEST block.
+func CSRToPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  pemTypeCSR,
+		Bytes: der,
+	})
+}
+
+// CSRFromPEM decodes the first PEM block in data, which must be a CERTIFICATE
+// REQUEST (or legacy NEW CERTIFICATE REQUEST) block, and returns its DER bytes.
+func CSRFromPEM(data []byte) ([]byte, error) {
+	return decodePEM(data, pemTypeCSR, pemTypeLegacyCSR)
+}
+
+// BulkEncode encodes each DER encoded CSR as a PEM CERTIFICATE REQUEST block
+// and concatenates them, e.g. for CA portals which accept several CSRs at once.
+func BulkEncode(csrs [][]byte) []byte {
+	var out []byte
+	for _, der := range csrs {
+		out = append(out, CSRToPEM(der)...)
+	}
+	return out
+}
+
+// BulkDecode splits data into the DER bytes of each of its PEM blocks, which
+// must all be CERTIFICATE REQUEST (or legacy NEW CERTIFICATE REQUEST) blocks.
+func BulkDecode(data []byte) ([][]byte, error) {
+	var csrs [][]byte
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != pemTypeCSR && block.Type != pemTypeLegacyCSR {
+			return nil, fmt.Errorf("unexpected PEM block type %q, expected %q", block.Type, pemTypeCSR)
+		}
+		csrs = append(csrs, block.Bytes)
+		data = rest
+	}
+	if len(csrs) == 0 {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	return csrs, nil
+}
+
+// CertToPEM encodes a DER encoded certificate as a PEM CERTIFICATE block.
+func CertToPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  pemTypeCertificate,
+		Bytes: der,
+	})
+}
+
+// CertFromPEM decodes the first PEM block in data, which must be a
+// CERTIFICATE block, and returns its DER bytes.
+func CertFromPEM(data []byte) ([]byte, error) {
+	return decodePEM(data, pemTypeCertificate)
+}
+
+// EncodeBundle returns a PEM bundle holding the PKCS#8 PRIVATE KEY block for
+// key followed by the CERTIFICATE REQUEST block for a DER encoded CSR.
+func EncodeBundle(csrDER []byte, key crypto.Signer) ([]byte, error) {
+	keyDER, err := EncodePrivateKey(key, PKCS8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %v", err)
+	}
+	bundle := pem.EncodeToMemory(&pem.Block{
+		Type:  pemTypePrivateKey,
+		Bytes: keyDER,
+	})
+	return append(bundle, CSRToPEM(csrDER)...), nil
+}
+
+func decodePEM(data []byte, types ...string) ([]byte, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	for _, t := range types {
+		if block.Type == t {
+			return block.Bytes, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected PEM block type %q, expected %q", block.Type, types[0])
+}
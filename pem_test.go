@@ -0,0 +1,97 @@
+package eidas
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPEM(t *testing.T) {
+	Convey("CSR round trip", t, func() {
+		der, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		got, err := CSRFromPEM(CSRToPEM(der))
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, der)
+		_, err = x509.ParseCertificateRequest(got)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("legacy CSR block type", t, func() {
+		data := pem.EncodeToMemory(&pem.Block{Type: "NEW CERTIFICATE REQUEST", Bytes: []byte{1, 2, 3}})
+		got, err := CSRFromPEM(data)
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, []byte{1, 2, 3})
+	})
+
+	Convey("certificate round trip", t, func() {
+		got, err := CertFromPEM(CertToPEM([]byte{1, 2, 3}))
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, []byte{1, 2, 3})
+	})
+
+	Convey("wrong block type", t, func() {
+		_, err := CSRFromPEM(CertToPEM([]byte{1, 2, 3}))
+		So(err, ShouldBeError, `unexpected PEM block type "CERTIFICATE", expected "CERTIFICATE REQUEST"`)
+		_, err = CertFromPEM(CSRToPEM([]byte{1, 2, 3}))
+		So(err, ShouldBeError, `unexpected PEM block type "CERTIFICATE REQUEST", expected "CERTIFICATE"`)
+	})
+
+	Convey("malformed input", t, func() {
+		_, err := CSRFromPEM([]byte("not PEM"))
+		So(err, ShouldBeError, "no PEM data found")
+		_, err = CertFromPEM(nil)
+		So(err, ShouldBeError, "no PEM data found")
+	})
+}
+
+func TestEncodeBundle(t *testing.T) {
+	Convey("key and CSR bundle", t, func() {
+		der, key, err := GenerateCSRWithAlgorithm(ECP256, "GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		bundle, err := EncodeBundle(der, key)
+		So(err, ShouldBeNil)
+
+		keyBlock, rest := pem.Decode(bundle)
+		So(keyBlock, ShouldNotBeNil)
+		So(keyBlock.Type, ShouldEqual, "PRIVATE KEY")
+		parsedKey, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		So(err, ShouldBeNil)
+		So(parsedKey.(*ecdsa.PrivateKey).Equal(key), ShouldBeTrue)
+
+		csrBlock, rest := pem.Decode(rest)
+		So(csrBlock, ShouldNotBeNil)
+		So(csrBlock.Type, ShouldEqual, "CERTIFICATE REQUEST")
+		So(csrBlock.Bytes, ShouldResemble, der)
+		So(rest, ShouldBeEmpty)
+	})
+}
+
+func TestBulkEncode(t *testing.T) {
+	Convey("three CSRs round trip", t, func() {
+		var csrs [][]byte
+		for _, role := range []qcstatements.Role{qcstatements.RoleAccountInformation, qcstatements.RolePaymentInitiation, qcstatements.RoleAccountServicing} {
+			der, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{role}, qcstatements.QSEALType)
+			So(err, ShouldBeNil)
+			csrs = append(csrs, der)
+		}
+		got, err := BulkDecode(BulkEncode(csrs))
+		So(err, ShouldBeNil)
+		So(got, ShouldResemble, csrs)
+	})
+
+	Convey("bundle with a certificate", t, func() {
+		data := append(CSRToPEM([]byte{1, 2, 3}), CertToPEM([]byte{4, 5, 6})...)
+		_, err := BulkDecode(data)
+		So(err, ShouldBeError, `unexpected PEM block type "CERTIFICATE", expected "CERTIFICATE REQUEST"`)
+	})
+
+	Convey("no PEM data", t, func() {
+		_, err := BulkDecode([]byte("foo"))
+		So(err, ShouldBeError, "no PEM data found")
+	})
+}
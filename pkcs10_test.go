@@ -0,0 +1,202 @@
+package eidas
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"testing"
+
+	"github.com/apple/eidas/internal/pkcs10"
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// attributeTypes returns the types of the attributes in a parsed CSR.
+func attributeTypes(csr *x509.CertificateRequest) []asn1.ObjectIdentifier {
+	var tbs pkcs10.TBSCertificateRequest
+	_, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs)
+	So(err, ShouldBeNil)
+	var types []asn1.ObjectIdentifier
+	for _, raw := range tbs.RawAttributes {
+		var attr pkcs10.Attribute
+		_, err := asn1.Unmarshal(raw.FullBytes, &attr)
+		So(err, ShouldBeNil)
+		types = append(types, attr.Type)
+	}
+	return types
+}
+
+func TestExtensionRequestAttribute(t *testing.T) {
+	Convey("extensionRequest attribute is present by default", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(attributeTypes(csr), ShouldResemble, []asn1.ObjectIdentifier{pkcs10.OIDExtensionRequest})
+	})
+
+	Convey("extensionRequest attribute cannot drop extensions", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithExtensionRequestAttribute(false), WithDNSName("example.com"))
+		So(err, ShouldEqual, ErrExtensionsDropped)
+	})
+
+	Convey("extensionRequest attribute omitted without extensions", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		tbs, err := buildTBSCertificateRequest(&x509.CertificateRequest{}, key, newCertificateOptions([]CertificateOption{WithExtensionRequestAttribute(false)}))
+		So(err, ShouldBeNil)
+		So(tbs.RawAttributes, ShouldBeEmpty)
+	})
+
+	Convey("empty extensionRequest attribute encodes validly", t, func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		So(err, ShouldBeNil)
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "Foo Name"},
+		}, key)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(der)
+		So(err, ShouldBeNil)
+		So(attributeTypes(csr), ShouldBeEmpty)
+
+		attr, err := pkcs10.ExtensionRequestAttribute(nil)
+		So(err, ShouldBeNil)
+		der, err = pkcs10.Resign(rand.Reader, der, x509.SHA256WithRSA, key, func(tbs *pkcs10.TBSCertificateRequest) {
+			tbs.RawAttributes = append(tbs.RawAttributes, attr)
+		})
+		So(err, ShouldBeNil)
+		csr, err = x509.ParseCertificateRequest(der)
+		So(err, ShouldBeNil)
+		So(csr.CheckSignature(), ShouldBeNil)
+		So(attributeTypes(csr), ShouldResemble, []asn1.ObjectIdentifier{pkcs10.OIDExtensionRequest})
+		So(csr.Extensions, ShouldBeEmpty)
+	})
+}
+
+// recordingSigner records the options passed to each call to Sign.
+type recordingSigner struct {
+	crypto.Signer
+	opts []crypto.SignerOpts
+}
+
+func (s *recordingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.opts = append(s.opts, opts)
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestSignerOpts(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("PSS signer receives PSS options", t, func() {
+		signer := &recordingSigner{Signer: priv}
+		data, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, signer, WithSignatureAlgorithm(x509.SHA384WithRSAPSS), WithChallengePassword("secret"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		// Attributes are part of the TBS, so the CSR is signed only once.
+		So(signer.opts, ShouldHaveLength, 1)
+		for _, opts := range signer.opts {
+			pss, ok := opts.(*rsa.PSSOptions)
+			So(ok, ShouldBeTrue)
+			So(pss.Hash, ShouldEqual, crypto.SHA384)
+			So(pss.SaltLength, ShouldEqual, rsa.PSSSaltLengthEqualsHash)
+		}
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.CheckSignature(), ShouldBeNil)
+	})
+
+	Convey("PKCS#1 v1.5 signer receives the hash", t, func() {
+		signer := &recordingSigner{Signer: priv}
+		_, err := GenerateCSRWithKey("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, signer, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		So(signer.opts, ShouldResemble, []crypto.SignerOpts{crypto.SHA256})
+	})
+}
+
+func TestSignCertificateRequest(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "Foo Name"},
+		DNSNames: []string{"example.com"},
+	}
+
+	Convey("matches crypto/x509 for deterministic signatures", t, func() {
+		for _, tc := range []struct {
+			alg  x509.SignatureAlgorithm
+			priv crypto.Signer
+		}{
+			{x509.SHA256WithRSA, rsaKey},
+			{x509.SHA512WithRSA, rsaKey},
+			{x509.PureEd25519, edKey},
+		} {
+			template.SignatureAlgorithm = tc.alg
+			want, err := x509.CreateCertificateRequest(rand.Reader, template, tc.priv)
+			So(err, ShouldBeNil)
+			parsed, err := x509.ParseCertificateRequest(want)
+			So(err, ShouldBeNil)
+			tbs, err := buildTBSCertificateRequest(&x509.CertificateRequest{
+				RawSubject: parsed.RawSubject,
+				DNSNames:   template.DNSNames,
+			}, tc.priv, &certificateOptions{})
+			So(err, ShouldBeNil)
+			got, err := pkcs10.Sign(rand.Reader, *tbs, tc.alg, tc.priv)
+			So(err, ShouldBeNil)
+			So(got, ShouldResemble, want)
+		}
+	})
+
+	Convey("attributes are DER sorted", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QWACType, WithChallengePassword("secret"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.CheckSignature(), ShouldBeNil)
+		var tbs pkcs10.TBSCertificateRequest
+		_, err = asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs)
+		So(err, ShouldBeNil)
+		So(tbs.RawAttributes, ShouldHaveLength, 2)
+		So(bytes.Compare(tbs.RawAttributes[0].FullBytes, tbs.RawAttributes[1].FullBytes), ShouldBeLessThan, 0)
+	})
+}
+
+func TestCSRVersion(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("default version", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Version, ShouldEqual, 0)
+	})
+
+	Convey("custom version", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithCSRVersion(2))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(csr.Version, ShouldEqual, 2)
+		So(csr.CheckSignature(), ShouldBeNil)
+	})
+
+	Convey("negative version", t, func() {
+		_, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QSEALType, WithCSRVersion(-1))
+		So(err, ShouldNotBeNil)
+	})
+}
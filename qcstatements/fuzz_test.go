@@ -0,0 +1,81 @@
+package qcstatements
+
+import (
+	"encoding/asn1"
+	"testing"
+)
+
+// fuzzSeeds returns QWAC and QSEAL qualified statements to seed the corpus.
+func fuzzSeeds(f *testing.F) [][]byte {
+	var seeds [][]byte
+	for _, t := range []asn1.ObjectIdentifier{QWACType, QSEALType} {
+		d, err := Serialize([]Role{RoleAccountServicing, RolePaymentInitiation}, defaultCA, t, WithLimitValue(MonetaryLimit{Amount: 100, Currency: "EUR"}))
+		if err != nil {
+			f.Fatal(err)
+		}
+		seeds = append(seeds, d)
+	}
+	return seeds
+}
+
+func FuzzExtract(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Only check that decoding doesn't panic.
+		Extract(data)
+		ExtractStrict(data)
+		ExtractTypes(data)
+		ExtractLimit(data)
+		ExtractCustom(data)
+		ExtractAll(data)
+		StatementOIDs(data)
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add(uint8(0x0f), defaultCA.Name, defaultCA.ID, false)
+	f.Add(uint8(0x04), "Bundesanstalt für Finanzdienstleistungsaufsicht", "DE-BAFIN", true)
+	allRoles := []Role{RoleAccountServicing, RolePaymentInitiation, RoleAccountInformation, RolePaymentInstruments}
+	f.Fuzz(func(t *testing.T, mask uint8, name string, id string, qseal bool) {
+		var roles []Role
+		for i, r := range allRoles {
+			if mask&(1<<uint(i)) != 0 {
+				roles = append(roles, r)
+			}
+		}
+		qcType := QWACType
+		if qseal {
+			qcType = QSEALType
+		}
+
+		d, err := Serialize(roles, CompetentAuthority{Name: name, ID: id}, qcType)
+		if err != nil {
+			// Names and IDs which aren't valid UTF-8 are rejected.
+			return
+		}
+		gotRoles, gotName, gotID, err := Extract(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gotRoles) != len(roles) {
+			t.Fatalf("Expected roles: %v but got %v", roles, gotRoles)
+		}
+		for i := range roles {
+			if gotRoles[i] != roles[i] {
+				t.Errorf("Expected roles: %v but got %v", roles, gotRoles)
+			}
+		}
+		if gotName != name || gotID != id {
+			t.Errorf("Expected CA: %q %q but got %q %q", name, id, gotName, gotID)
+		}
+		gotTypes, err := ExtractTypes(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(gotTypes) != 1 || !gotTypes[0].Equal(qcType) {
+			t.Errorf("Expected types: [%v] but got %v", qcType, gotTypes)
+		}
+	})
+}
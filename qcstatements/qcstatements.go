@@ -4,9 +4,16 @@
 package qcstatements
 
 import (
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Role represents the role of the Payment Service Provider (PSP).
@@ -20,149 +27,338 @@ const (
 	RolePaymentInstruments Role = "PSP_IC"
 )
 
+var roleNames = map[Role]string{
+	RoleAccountServicing:   "Account Servicing",
+	RolePaymentInitiation:  "Payment Initiation",
+	RoleAccountInformation: "Account Information",
+	RolePaymentInstruments: "Issuing of Card-Based Payment Instruments",
+}
+
+// Common abbreviations for the PSP roles.
+var roleAbbreviations = map[string]Role{
+	"ASPSP": RoleAccountServicing,
+	"PIS":   RolePaymentInitiation,
+	"AIS":   RoleAccountInformation,
+	"PIISP": RolePaymentInstruments,
+}
+
+// String returns the human-readable name of the role, e.g. "Account Information".
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return string(r)
+}
+
+// RoleFromString parses a role from its abbreviation (e.g. "AIS"), its
+// human-readable name (e.g. "Account Information") or its ETSI role name
+// (e.g. "PSP_AI"). Matching is case-insensitive.
+func RoleFromString(s string) (Role, error) {
+	s = strings.TrimSpace(s)
+	if r, ok := roleAbbreviations[strings.ToUpper(s)]; ok {
+		return r, nil
+	}
+	for r, name := range roleNames {
+		if strings.EqualFold(s, name) || strings.EqualFold(s, string(r)) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role: %s", s)
+}
+
+// OID returns the ETSI RoleOfPSP identifier of the role, e.g. 0.4.0.19495.1.3
+// for RoleAccountInformation, or nil if the role is unknown.
+func (r Role) OID() asn1.ObjectIdentifier {
+	n, ok := roleMap[r]
+	if !ok {
+		return nil
+	}
+	return asn1.ObjectIdentifier{0, 4, 0, 19495, 1, n}
+}
+
+// RoleFromOID returns the role with the given ETSI RoleOfPSP identifier.
+func RoleFromOID(oid asn1.ObjectIdentifier) (Role, error) {
+	for r := range roleMap {
+		if r.OID().Equal(oid) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role OID: %v", oid)
+}
+
 // CompetentAuthority under PSD2.
 type CompetentAuthority struct {
 	// Name of the authority, e.g. "Financial Conduct Authority".
 	Name string
 	// NCA identifier of the authority, e.g. "GB-FCA".
 	ID string
+	// Country is the ISO-3166-1 alpha-2 code of the authority's country, e.g. "GB".
+	Country string
+	// LocalizedNames maps ISO 639-1 language codes, e.g. "de", to the name of
+	// the authority in that language.
+	LocalizedNames map[string]string
+}
+
+// LocalizedName returns the name of the authority in the given language, or
+// Name if no localized name is known.
+func (ca CompetentAuthority) LocalizedName(lang string) string {
+	if name, ok := ca.LocalizedNames[lang]; ok {
+		return name
+	}
+	return ca.Name
+}
+
+// clone returns a copy of ca which shares no state with it.
+func (ca *CompetentAuthority) clone() *CompetentAuthority {
+	c := *ca
+	if ca.LocalizedNames != nil {
+		c.LocalizedNames = make(map[string]string, len(ca.LocalizedNames))
+		for lang, name := range ca.LocalizedNames {
+			c.LocalizedNames[lang] = name
+		}
+	}
+	return &c
 }
 
 // CompetentAuthorityForCountryCode returns the correct competent authority
-// string, e.g., "GB-FCA", based on the given country code.
+// string, e.g., "GB-FCA", based on the given country code. The result is a
+// copy which the caller may modify.
 func CompetentAuthorityForCountryCode(code string) (*CompetentAuthority, error) {
 	if ca, ok := caMap[code]; ok {
-		return ca, nil
+		return ca.clone(), nil
 	}
 	return nil, fmt.Errorf("unknown country code: %s", code)
 }
 
+// CompetentAuthorityByID returns the competent authority with the given NCA
+// identifier, e.g. "GB-FCA". The result is a copy which the caller may modify.
+func CompetentAuthorityByID(id string) (*CompetentAuthority, error) {
+	if ca, ok := caByID[id]; ok {
+		return ca.clone(), nil
+	}
+	return nil, fmt.Errorf("unknown competent authority: %s", id)
+}
+
+// caByID indexes caMap by NCA identifier.
+var caByID = func() map[string]*CompetentAuthority {
+	m := make(map[string]*CompetentAuthority, len(caMap))
+	for _, ca := range caMap {
+		m[ca.ID] = ca
+	}
+	return m
+}()
+
+// SupportedCountries returns the sorted ISO-3166-1 alpha-2 country codes which
+// have a known competent authority.
+func SupportedCountries() []string {
+	codes := make([]string, 0, len(caMap))
+	for code := range caMap {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
 // Maps ISO-3166-1 alpha-2 codes to a CompetentAuthority.
 // See ETSI TS 119 495 V1.2.1 (2018-11) Annex D.
 var caMap = map[string]*CompetentAuthority{
 	"AT": {
-		ID:   "AT-FMA",
-		Name: "Austria Financial Market Authority",
+		ID:      "AT-FMA",
+		Name:    "Austria Financial Market Authority",
+		Country: "AT",
+		LocalizedNames: map[string]string{
+			"de": "Finanzmarktaufsicht",
+		},
 	},
 	"BE": {
-		ID:   "BE-NBB",
-		Name: "National Bank of Belgium",
+		ID:      "BE-NBB",
+		Name:    "National Bank of Belgium",
+		Country: "BE",
+		LocalizedNames: map[string]string{
+			"nl": "Nationale Bank van België",
+			"fr": "Banque nationale de Belgique",
+		},
 	},
 	"BG": {
-		ID:   "BG-BNB",
-		Name: "Bulgarian National Bank",
+		ID:      "BG-BNB",
+		Name:    "Bulgarian National Bank",
+		Country: "BG",
 	},
 	"HR": {
-		ID:   "HR-CNB",
-		Name: "Croatian National Bank",
+		ID:      "HR-CNB",
+		Name:    "Croatian National Bank",
+		Country: "HR",
 	},
 	"CY": {
-		ID:   "CY-CBC",
-		Name: "Central Bank of Cyprus",
+		ID:      "CY-CBC",
+		Name:    "Central Bank of Cyprus",
+		Country: "CY",
 	},
 	"CZ": {
-		ID:   "CZ-CNB",
-		Name: "Czech National Bank",
+		ID:      "CZ-CNB",
+		Name:    "Czech National Bank",
+		Country: "CZ",
 	},
 	"DK": {
-		ID:   "DK-DFSA",
-		Name: "Danish Financial Supervisory Authority",
+		ID:      "DK-DFSA",
+		Name:    "Danish Financial Supervisory Authority",
+		Country: "DK",
+		LocalizedNames: map[string]string{
+			"da": "Finanstilsynet",
+		},
 	},
 	"EE": {
-		ID:   "EE-FI",
-		Name: "Estonia Financial Supervisory Authority",
+		ID:      "EE-FI",
+		Name:    "Estonia Financial Supervisory Authority",
+		Country: "EE",
 	},
 	"FI": {
-		ID:   "FI-FINFSA",
-		Name: "Finnish Financial Supervisory Authority",
+		ID:      "FI-FINFSA",
+		Name:    "Finnish Financial Supervisory Authority",
+		Country: "FI",
 	},
 	"FR": {
-		ID:   "FR-ACPR",
-		Name: "Prudential Supervisory and Resolution Authority",
+		ID:      "FR-ACPR",
+		Name:    "Prudential Supervisory and Resolution Authority",
+		Country: "FR",
+		LocalizedNames: map[string]string{
+			"fr": "Autorité de contrôle prudentiel et de résolution",
+		},
 	},
 	"DE": {
-		ID:   "DE-BAFIN",
-		Name: "Federal Financial Supervisory Authority",
+		ID:      "DE-BAFIN",
+		Name:    "Federal Financial Supervisory Authority",
+		Country: "DE",
+		LocalizedNames: map[string]string{
+			"de": "Bundesanstalt für Finanzdienstleistungsaufsicht",
+		},
 	},
 	"GR": {
-		ID:   "GR-BOG",
-		Name: "Bank of Greece",
+		ID:      "GR-BOG",
+		Name:    "Bank of Greece",
+		Country: "GR",
 	},
 	"HU": {
-		ID:   "HU-CBH",
-		Name: "Central Bank of Hungary",
+		ID:      "HU-CBH",
+		Name:    "Central Bank of Hungary",
+		Country: "HU",
 	},
 	"IS": {
-		ID:   "IS-FME",
-		Name: "Financial Supervisory Authority",
+		ID:      "IS-FME",
+		Name:    "Financial Supervisory Authority",
+		Country: "IS",
 	},
 	"IE": {
-		ID:   "IE-CBI",
-		Name: "Central Bank of Ireland",
+		ID:      "IE-CBI",
+		Name:    "Central Bank of Ireland",
+		Country: "IE",
 	},
 	"IT": {
-		ID:   "IT-BI",
-		Name: "Bank of Italy",
+		ID:      "IT-BI",
+		Name:    "Bank of Italy",
+		Country: "IT",
+		LocalizedNames: map[string]string{
+			"it": "Banca d'Italia",
+		},
 	},
 	"LI": {
-		ID:   "LI-FMA",
-		Name: "Financial Market Authority Liechtenstein",
+		ID:      "LI-FMA",
+		Name:    "Financial Market Authority Liechtenstein",
+		Country: "LI",
+		LocalizedNames: map[string]string{
+			"de": "Finanzmarktaufsicht Liechtenstein",
+		},
 	},
 	"LV": {
-		ID:   "LV-FCMC",
-		Name: "Financial and Capital Markets Commission",
+		ID:      "LV-FCMC",
+		Name:    "Financial and Capital Markets Commission",
+		Country: "LV",
 	},
 	"LT": {
-		ID:   "LT-BL",
-		Name: "Bank of Lithuania",
+		ID:      "LT-BL",
+		Name:    "Bank of Lithuania",
+		Country: "LT",
 	},
 	"LU": {
-		ID:   "LU-CSSF",
-		Name: "Commission for the Supervision of Financial Sector",
+		ID:      "LU-CSSF",
+		Name:    "Commission for the Supervision of Financial Sector",
+		Country: "LU",
+		LocalizedNames: map[string]string{
+			"fr": "Commission de Surveillance du Secteur Financier",
+		},
 	},
 	"NO": {
-		ID:   "NO-FSA",
-		Name: "The Financial Supervisory Authority of Norway",
+		ID:      "NO-FSA",
+		Name:    "The Financial Supervisory Authority of Norway",
+		Country: "NO",
+		LocalizedNames: map[string]string{
+			"no": "Finanstilsynet",
+		},
 	},
 	"MT": {
-		ID:   "MT-MFSA",
-		Name: "Malta Financial Services Authority",
+		ID:      "MT-MFSA",
+		Name:    "Malta Financial Services Authority",
+		Country: "MT",
 	},
 	"NL": {
-		ID:   "NL-DNB",
-		Name: "The Netherlands Bank",
+		ID:      "NL-DNB",
+		Name:    "The Netherlands Bank",
+		Country: "NL",
+		LocalizedNames: map[string]string{
+			"nl": "De Nederlandsche Bank",
+		},
 	},
 	"PL": {
-		ID:   "PL-PFSA",
-		Name: "Polish Financial Supervision Authority",
+		ID:      "PL-PFSA",
+		Name:    "Polish Financial Supervision Authority",
+		Country: "PL",
+		LocalizedNames: map[string]string{
+			"pl": "Komisja Nadzoru Finansowego",
+		},
 	},
 	"PT": {
-		ID:   "PT-BP",
-		Name: "Bank of Portugal",
+		ID:      "PT-BP",
+		Name:    "Bank of Portugal",
+		Country: "PT",
+		LocalizedNames: map[string]string{
+			"pt": "Banco de Portugal",
+		},
 	},
 	"RO": {
-		ID:   "RO-NBR",
-		Name: "National bank of Romania",
+		ID:      "RO-NBR",
+		Name:    "National bank of Romania",
+		Country: "RO",
 	},
 	"SK": {
-		ID:   "SK-NBS",
-		Name: "National Bank of Slovakia",
+		ID:      "SK-NBS",
+		Name:    "National Bank of Slovakia",
+		Country: "SK",
 	},
 	"SI": {
-		ID:   "SI-BS",
-		Name: "Bank of Slovenia",
+		ID:      "SI-BS",
+		Name:    "Bank of Slovenia",
+		Country: "SI",
 	},
 	"ES": {
-		ID:   "ES-BE",
-		Name: "Bank of Spain",
+		ID:      "ES-BE",
+		Name:    "Bank of Spain",
+		Country: "ES",
+		LocalizedNames: map[string]string{
+			"es": "Banco de España",
+		},
 	},
 	"SE": {
-		ID:   "SE-FINA",
-		Name: "Swedish Financial Supervision Authority",
+		ID:      "SE-FINA",
+		Name:    "Swedish Financial Supervision Authority",
+		Country: "SE",
+		LocalizedNames: map[string]string{
+			"sv": "Finansinspektionen",
+		},
 	},
 	"GB": {
-		ID:   "GB-FCA",
-		Name: "Financial Conduct Authority",
+		ID:      "GB-FCA",
+		Name:    "Financial Conduct Authority",
+		Country: "GB",
 	},
 }
 
@@ -173,23 +369,44 @@ var roleMap = map[Role]int{
 	RolePaymentInstruments: 4,
 }
 
-type root struct {
-	QcType      qcType
-	QcStatement qcStatement
-}
-
 type qcType struct {
 	OID    asn1.ObjectIdentifier
 	Detail []asn1.ObjectIdentifier
 }
 
 var (
+	// QESIGNType is the ASN.1 object identifier for qualified electronic
+	// signature certificates.
+	QESIGNType = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 1}
 	// QSEALType is the ASN.1 object identifier for QSeal certificates.
 	QSEALType = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 2}
 	// QWACType is the ASN.1 object identifier for QWA certificates.
 	QWACType = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6, 3}
 )
 
+// Statement identifiers from ETSI EN 319 412-5 Section 5 and, for PSD2, ETSI
+// TS 119 495 Section 5.1.
+var (
+	// QcComplianceOID identifies the QcCompliance statement, claiming the
+	// certificate is an EU qualified certificate.
+	QcComplianceOID = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 1}
+	// QcLimitValueOID identifies the QcLimitValue statement.
+	QcLimitValueOID = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 2}
+	// QcRetentionPeriodOID identifies the QcRetentionPeriod statement.
+	QcRetentionPeriodOID = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 3}
+	// QcSSCDOID identifies the QcSSCD statement, claiming the private key is
+	// held in a qualified signature or seal creation device.
+	QcSSCDOID = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 4}
+	// QcPDSOID identifies the QcPDS statement listing PKI disclosure
+	// statements.
+	QcPDSOID = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 5}
+	// QcTypeOID identifies the QcType statement.
+	QcTypeOID = asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6}
+	// PSD2OID identifies the PSD2 statement carrying the roles and competent
+	// authority.
+	PSD2OID = asn1.ObjectIdentifier{0, 4, 0, 19495, 2}
+)
+
 type qcStatement struct {
 	OID       asn1.ObjectIdentifier
 	RolesInfo rolesInfo
@@ -207,14 +424,387 @@ type role struct {
 	Role Role
 }
 
+// statement is a generic QCStatement as defined in RFC 3739.
+type statement struct {
+	OID  asn1.ObjectIdentifier
+	Info asn1.RawValue `asn1:"optional"`
+}
+
+// MonetaryLimit is the value of a QcLimitValue statement, representing
+// Amount * 10^Exponent in the given ISO 4217 currency.
+// See ETSI EN 319 412-5 Section 4.3.2.
+type MonetaryLimit struct {
+	Amount   int64
+	Exponent int
+	// Currency is the ISO 4217 alphabetic currency code, e.g. "EUR", or with
+	// NumericCurrency set, the three digit numeric code, e.g. "978".
+	Currency string
+	// NumericCurrency selects the INTEGER encoding of the currency rather
+	// than the PrintableString, so that extracted limits serialize to the
+	// same DER.
+	NumericCurrency bool
+}
+
+// ErrLimitAmountRange is returned when a QcLimitValue amount doesn't fit
+// in the int64 Amount of a MonetaryLimit.
+var ErrLimitAmountRange = errors.New("qcstatements: limit amount out of int64 range")
+
+type monetaryValue struct {
+	Currency asn1.RawValue
+	Amount   int64
+	Exponent int
+}
+
+// currencyValue encodes the currency of l as a PrintableString or, with
+// NumericCurrency, an INTEGER.
+func (l MonetaryLimit) currencyValue() (asn1.RawValue, error) {
+	if len(l.Currency) != 3 {
+		return asn1.RawValue{}, fmt.Errorf("invalid currency code: %q", l.Currency)
+	}
+	if !l.NumericCurrency {
+		d, err := asn1.MarshalWithParams(l.Currency, "printable")
+		if err != nil {
+			return asn1.RawValue{}, fmt.Errorf("invalid currency code: %q", l.Currency)
+		}
+		return asn1.RawValue{FullBytes: d}, nil
+	}
+	code := 0
+	for _, c := range []byte(l.Currency) {
+		if c < '0' || c > '9' {
+			return asn1.RawValue{}, fmt.Errorf("invalid numeric currency code: %q", l.Currency)
+		}
+		code = code*10 + int(c-'0')
+	}
+	if code == 0 {
+		return asn1.RawValue{}, fmt.Errorf("invalid numeric currency code: %q", l.Currency)
+	}
+	d, err := asn1.Marshal(code)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: d}, nil
+}
+
+// rawMonetaryValue is used to decode a MonetaryValue, whose currency may be
+// either alphabetic or numeric and whose amount may be arbitrarily large.
+type rawMonetaryValue struct {
+	Currency asn1.RawValue
+	Amount   *big.Int
+	Exponent int
+}
+
+// maxLimitExponent bounds the magnitude of a MonetaryLimit exponent, so that
+// computing its value stays cheap. 10^18 already exceeds any real limit.
+const maxLimitExponent = 18
+
+// checkLimitExponent returns an error if exp is outside
+// [-maxLimitExponent, maxLimitExponent].
+func checkLimitExponent(exp int) error {
+	if exp < -maxLimitExponent || exp > maxLimitExponent {
+		return fmt.Errorf("limit exponent %d out of range [%d, %d]", exp, -maxLimitExponent, maxLimitExponent)
+	}
+	return nil
+}
+
+// Value returns Amount * 10^Exponent exactly, e.g. 12345 with exponent -2 is
+// 123.45. It returns an error if the exponent is out of range.
+func (l MonetaryLimit) Value() (*big.Rat, error) {
+	if err := checkLimitExponent(l.Exponent); err != nil {
+		return nil, err
+	}
+	exp := l.Exponent
+	if exp < 0 {
+		exp = -exp
+	}
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil))
+	v := new(big.Rat).SetInt64(l.Amount)
+	if l.Exponent < 0 {
+		return v.Quo(v, scale), nil
+	}
+	return v.Mul(v, scale), nil
+}
+
+// decodeLimit decodes a MonetaryValue. A numeric ISO 4217 currency code is
+// returned as its three digit string, e.g. "978" for euros.
+func decodeLimit(data []byte) (*MonetaryLimit, error) {
+	var v rawMonetaryValue
+	rest, err := asn1.Unmarshal(data, &v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode limit value: %v", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("failed to decode limit value: %d trailing bytes", len(rest))
+	}
+	if err := checkLimitExponent(v.Exponent); err != nil {
+		return nil, err
+	}
+	limit := &MonetaryLimit{Exponent: v.Exponent}
+	switch {
+	case v.Currency.Class == asn1.ClassUniversal && v.Currency.Tag == asn1.TagPrintableString:
+		limit.Currency = string(v.Currency.Bytes)
+	case v.Currency.Class == asn1.ClassUniversal && v.Currency.Tag == asn1.TagInteger:
+		var code int
+		if _, err := asn1.Unmarshal(v.Currency.FullBytes, &code); err != nil {
+			return nil, fmt.Errorf("failed to decode limit currency: %v", err)
+		}
+		if code < 1 || code > 999 {
+			return nil, fmt.Errorf("invalid numeric currency code: %d", code)
+		}
+		limit.Currency = fmt.Sprintf("%03d", code)
+		limit.NumericCurrency = true
+	default:
+		return nil, fmt.Errorf("failed to decode limit currency: unexpected tag %d", v.Currency.Tag)
+	}
+	if !v.Amount.IsInt64() {
+		return nil, ErrLimitAmountRange
+	}
+	limit.Amount = v.Amount.Int64()
+	return limit, nil
+}
+
+type limitStatement struct {
+	OID   asn1.ObjectIdentifier
+	Value monetaryValue
+}
+
+// SerializeOption adds optional statements to a serialized qualified statement.
+type SerializeOption func(*serializeOptions)
+
+type serializeOptions struct {
+	compliance bool
+	limit      *MonetaryLimit
+	pds        []PDSLocation
+	custom     []RawStatement
+	language   string
+}
+
+// WithLanguage selects the localized name of the competent authority in the
+// given ISO 639-1 language, e.g. "de", falling back to its default name.
+func WithLanguage(lang string) SerializeOption {
+	return func(o *serializeOptions) {
+		o.language = lang
+	}
+}
+
+// WithCompliance adds a QcCompliance statement, claiming the certificate is
+// an EU qualified certificate, before the other statements. See ETSI EN 319
+// 412-5 Section 4.2.1.
+func WithCompliance() SerializeOption {
+	return func(o *serializeOptions) {
+		o.compliance = true
+	}
+}
+
+// WithLimitValue adds a QcLimitValue statement limiting the value of
+// transactions for which the certificate can be used.
+func WithLimitValue(limit MonetaryLimit) SerializeOption {
+	return func(o *serializeOptions) {
+		o.limit = &limit
+	}
+}
+
+// PDSLocation is the location of a PKI disclosure statement in one language.
+type PDSLocation struct {
+	// URL of the disclosure statement, e.g. "https://example.com/pds_en.pdf".
+	URL string
+	// Language is the ISO 639-1 code of the statement's language, e.g. "en".
+	Language string
+}
+
+type pdsLocation struct {
+	URL      string `asn1:"ia5"`
+	Language string `asn1:"printable"`
+}
+
+type pdsStatement struct {
+	OID       asn1.ObjectIdentifier
+	Locations []pdsLocation
+}
+
+// WithPDSLocations adds a QcPDS statement listing the given PKI disclosure
+// statements. See ETSI EN 319 412-5 Section 4.3.4.
+func WithPDSLocations(locations ...PDSLocation) SerializeOption {
+	return func(o *serializeOptions) {
+		o.pds = append(o.pds, locations...)
+	}
+}
+
+// validatePDSLocation checks that the URL is a non-empty IA5String and the
+// language is a two-letter ISO 639-1 code.
+func validatePDSLocation(l PDSLocation) error {
+	if l.URL == "" {
+		return fmt.Errorf("PDS location must have a URL")
+	}
+	for _, c := range l.URL {
+		if c > unicode.MaxASCII {
+			return fmt.Errorf("invalid PDS URL %q: must be ASCII", l.URL)
+		}
+	}
+	if len(l.Language) != 2 {
+		return fmt.Errorf("invalid PDS language %q: must be a two-letter ISO 639-1 code", l.Language)
+	}
+	for _, c := range l.Language {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return fmt.Errorf("invalid PDS language %q: must be a two-letter ISO 639-1 code", l.Language)
+		}
+	}
+	return nil
+}
+
+// decodePDS decodes the locations of a QcPDS statement.
+func decodePDS(data []byte) ([]PDSLocation, error) {
+	var locations []pdsLocation
+	rest, err := asn1.Unmarshal(data, &locations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode PDS locations: %v", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("failed to decode PDS locations: %d trailing bytes", len(rest))
+	}
+	pds := make([]PDSLocation, len(locations))
+	for i, l := range locations {
+		pds[i] = PDSLocation{URL: l.URL, Language: l.Language}
+	}
+	return pds, nil
+}
+
+// RawStatement is a QCStatement not otherwise understood by this package, e.g.
+// one defined by a national scheme.
+type RawStatement struct {
+	ID asn1.ObjectIdentifier
+	// Value is the DER encoded statementInfo, or nil if the statement has none.
+	Value []byte
+}
+
+// WithStatement appends an arbitrary statement with the given object
+// identifier and DER encoded statementInfo. value may be nil for statements
+// without statementInfo.
+func WithStatement(id asn1.ObjectIdentifier, value []byte) SerializeOption {
+	return func(o *serializeOptions) {
+		o.custom = append(o.custom, RawStatement{ID: id, Value: value})
+	}
+}
+
 // Serialize will serialize the given roles and CA information into a DER encoded ASN.1 qualified statement. qcType should be one of QWACType or QSEALType.
-func Serialize(roles []Role, ca CompetentAuthority, t asn1.ObjectIdentifier) ([]byte, error) {
+func Serialize(roles []Role, ca CompetentAuthority, t asn1.ObjectIdentifier, opts ...SerializeOption) ([]byte, error) {
+	return SerializeTypes(roles, ca, []asn1.ObjectIdentifier{t}, opts...)
+}
+
+// SerializeTypes is like Serialize but lists each of the given types, e.g.
+// QESIGNType and QSEALType, in the QcType statement.
+func SerializeTypes(roles []Role, ca CompetentAuthority, types []asn1.ObjectIdentifier, opts ...SerializeOption) ([]byte, error) {
+	if len(types) == 0 {
+		return nil, fmt.Errorf("at least one QcType is required")
+	}
+	o := &serializeOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.language != "" {
+		ca.Name = ca.LocalizedName(o.language)
+	}
+	psd2, err := psd2Statement(roles, ca)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []interface{}
+	if o.compliance {
+		statements = append(statements, struct{ OID asn1.ObjectIdentifier }{QcComplianceOID})
+	}
+	statements = append(statements,
+		qcType{
+			OID:    QcTypeOID,
+			Detail: types,
+		},
+		psd2,
+	)
+	if o.limit != nil {
+		currency, err := o.limit.currencyValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkLimitExponent(o.limit.Exponent); err != nil {
+			return nil, err
+		}
+		statements = append(statements, limitStatement{
+			OID: QcLimitValueOID,
+			Value: monetaryValue{
+				Currency: currency,
+				Amount:   o.limit.Amount,
+				Exponent: o.limit.Exponent,
+			},
+		})
+	}
+
+	if len(o.pds) != 0 {
+		pds := pdsStatement{OID: QcPDSOID}
+		for _, l := range o.pds {
+			if err := validatePDSLocation(l); err != nil {
+				return nil, err
+			}
+			pds.Locations = append(pds.Locations, pdsLocation{URL: l.URL, Language: l.Language})
+		}
+		statements = append(statements, pds)
+	}
+
+	for _, c := range o.custom {
+		st := statement{OID: c.ID}
+		if c.Value != nil {
+			rest, err := asn1.Unmarshal(c.Value, &st.Info)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for statement %v: %v", c.ID, err)
+			}
+			if len(rest) != 0 {
+				return nil, fmt.Errorf("invalid value for statement %v: %d trailing bytes", c.ID, len(rest))
+			}
+		}
+		statements = append(statements, st)
+	}
+
+	raw := make([]asn1.RawValue, len(statements))
+	for i, st := range statements {
+		d, err := asn1.Marshal(st)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal eIDAS: %v", err)
+		}
+		raw[i] = asn1.RawValue{FullBytes: d}
+	}
+	fin, err := asn1.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal eIDAS: %v", err)
+	}
+	return fin, nil
+}
+
+// SerializePSD2Only serializes the given roles and CA information into a DER
+// encoded PSD2 QCStatement (0.4.0.19495.2) alone, without the QCStatements
+// SEQUENCE or the ETSI QcType statement.
+func SerializePSD2Only(roles []Role, ca CompetentAuthority) ([]byte, error) {
+	psd2, err := psd2Statement(roles, ca)
+	if err != nil {
+		return nil, err
+	}
+	d, err := asn1.Marshal(psd2)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal eIDAS: %v", err)
+	}
+	return d, nil
+}
+
+func psd2Statement(roles []Role, ca CompetentAuthority) (qcStatement, error) {
+	// NCAName and NCAId are encoded as UTF8String.
+	if !utf8.ValidString(ca.Name) || !utf8.ValidString(ca.ID) {
+		return qcStatement{}, fmt.Errorf("competent authority name and ID must be valid UTF-8")
+	}
+
 	r := make([]role, len(roles))
 	for i, rv := range roles {
-		if _, ok := roleMap[rv]; !ok {
-			return nil, fmt.Errorf("Unknown role: %s", rv)
+		oid := rv.OID()
+		if oid == nil {
+			return qcStatement{}, fmt.Errorf("Unknown role: %s", rv)
 		}
-		oid := asn1.ObjectIdentifier([]int{0, 4, 0, 19495, 1, roleMap[rv]})
 
 		r[i] = role{
 			OID:  oid,
@@ -222,24 +812,32 @@ func Serialize(roles []Role, ca CompetentAuthority, t asn1.ObjectIdentifier) ([]
 		}
 	}
 
-	fin, err := asn1.Marshal(root{
-		qcType{
-			OID:    asn1.ObjectIdentifier{0, 4, 0, 1862, 1, 6},
-			Detail: []asn1.ObjectIdentifier{t},
-		},
-		qcStatement{
-			OID: asn1.ObjectIdentifier{0, 4, 0, 19495, 2},
-			RolesInfo: rolesInfo{
-				Roles:  r,
-				CAName: ca.Name,
-				CAID:   ca.ID,
-			},
+	return qcStatement{
+		OID: PSD2OID,
+		RolesInfo: rolesInfo{
+			Roles:  r,
+			CAName: ca.Name,
+			CAID:   ca.ID,
 		},
-	})
+	}, nil
+}
+
+// ExtensionID is the object identifier of the qcStatements x509 extension.
+// See RFC 3739 Section 3.2.6.
+var ExtensionID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 3}
+
+// SerializeToExtension serializes the given roles and CA information like
+// Serialize and wraps the result in a non-critical qcStatements extension.
+func SerializeToExtension(roles []Role, ca CompetentAuthority, t asn1.ObjectIdentifier, opts ...SerializeOption) (pkix.Extension, error) {
+	d, err := Serialize(roles, ca, t, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to marshal eIDAS: %v", err)
+		return pkix.Extension{}, err
 	}
-	return fin, nil
+	return pkix.Extension{
+		Id:       ExtensionID,
+		Critical: false,
+		Value:    d,
+	}, nil
 }
 
 // Dump outputs to stdout a human-readable representation of an encoded qualified statement.
@@ -264,17 +862,220 @@ func DumpFromHex(h string) error {
 }
 
 // Extract returns the roles, CA name and CA ID from an encoded qualified statement.
+// Roles are returned in the order they are encoded, which Serialize preserves.
 func Extract(data []byte) ([]Role, string, string, error) {
-	var root root
-	_, err := asn1.Unmarshal(data, &root)
+	statements, err := parseStatements(data)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	for _, st := range statements {
+		if !st.OID.Equal(PSD2OID) {
+			continue
+		}
+		var info rolesInfo
+		if _, err := asn1.Unmarshal(st.Info.FullBytes, &info); err != nil {
+			return nil, "", "", fmt.Errorf("failed to decode eIDAS: %v", err)
+		}
+
+		roles := make([]Role, 0)
+		for _, role := range info.Roles {
+			roles = append(roles, role.Role)
+		}
+		return roles, info.CAName, info.CAID, nil
+	}
+	return nil, "", "", fmt.Errorf("failed to decode eIDAS: no PSD2 statement found")
+}
+
+// ExtractStrict is like Extract but returns an error if the data has trailing
+// bytes, if any statement has trailing or malformed content, or if it contains
+// statements other than those defined in this package.
+func ExtractStrict(data []byte) ([]Role, string, string, error) {
+	var statements []statement
+	rest, err := asn1.Unmarshal(data, &statements)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("failed to decode eIDAS: %v", err)
 	}
+	if len(rest) != 0 {
+		return nil, "", "", fmt.Errorf("failed to decode eIDAS: %d trailing bytes", len(rest))
+	}
 
-	roles := make([]Role, 0)
-	for _, role := range root.QcStatement.RolesInfo.Roles {
-		roles = append(roles, role.Role)
+	for _, st := range statements {
+		var v interface{}
+		switch {
+		case st.OID.Equal(QcComplianceOID), st.OID.Equal(QcSSCDOID):
+			if len(st.Info.FullBytes) != 0 {
+				return nil, "", "", fmt.Errorf("failed to decode statement %v: unexpected statementInfo", st.OID)
+			}
+			continue
+		case st.OID.Equal(QcRetentionPeriodOID):
+			// The number of years from ETSI EN 319 412-5 Section 4.3.3.
+			v = new(int)
+		case st.OID.Equal(QcTypeOID):
+			v = &[]asn1.ObjectIdentifier{}
+		case st.OID.Equal(PSD2OID):
+			v = &rolesInfo{}
+		case st.OID.Equal(QcLimitValueOID):
+			if _, err := decodeLimit(st.Info.FullBytes); err != nil {
+				return nil, "", "", fmt.Errorf("failed to decode statement %v: %v", st.OID, err)
+			}
+			continue
+		case st.OID.Equal(QcPDSOID):
+			if _, err := decodePDS(st.Info.FullBytes); err != nil {
+				return nil, "", "", fmt.Errorf("failed to decode statement %v: %v", st.OID, err)
+			}
+			continue
+		default:
+			return nil, "", "", fmt.Errorf("failed to decode eIDAS: unknown statement: %v", st.OID)
+		}
+		rest, err := asn1.Unmarshal(st.Info.FullBytes, v)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to decode statement %v: %v", st.OID, err)
+		}
+		if len(rest) != 0 {
+			return nil, "", "", fmt.Errorf("failed to decode statement %v: %d trailing bytes", st.OID, len(rest))
+		}
 	}
+	return Extract(data)
+}
 
-	return roles, root.QcStatement.RolesInfo.CAName, root.QcStatement.RolesInfo.CAID, nil
+// ExtractTypes returns every QcType listed in an encoded qualified statement,
+// in the order they are encoded.
+func ExtractTypes(data []byte) ([]asn1.ObjectIdentifier, error) {
+	all, err := ExtractAll(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(all.Types) == 0 {
+		return nil, fmt.Errorf("failed to decode eIDAS: no QcType statement found")
+	}
+	return all.Types, nil
+}
+
+// ExtractLimit returns the QcLimitValue from an encoded qualified statement,
+// or nil if no limit is present. It is decoded by ExtractAll.
+func ExtractLimit(data []byte) (*MonetaryLimit, error) {
+	all, err := ExtractAll(data)
+	if err != nil {
+		return nil, err
+	}
+	return all.Limit, nil
+}
+
+// ExtractCustom returns the statements of an encoded qualified statement
+// which are not defined by this package, in the order they appear.
+func ExtractCustom(data []byte) ([]RawStatement, error) {
+	statements, err := parseStatements(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var custom []RawStatement
+	for _, st := range statements {
+		if isKnownStatement(st.OID) {
+			continue
+		}
+		custom = append(custom, RawStatement{ID: st.OID, Value: st.Info.FullBytes})
+	}
+	return custom, nil
+}
+
+// isKnownStatement reports whether id is one of the statements this package
+// serializes and decodes.
+func isKnownStatement(id asn1.ObjectIdentifier) bool {
+	for _, known := range []asn1.ObjectIdentifier{QcComplianceOID, QcTypeOID, PSD2OID, QcLimitValueOID, QcPDSOID} {
+		if id.Equal(known) {
+			return true
+		}
+	}
+	return false
+}
+
+// StatementOIDs returns the object identifiers of the top-level statements of
+// an encoded qualified statement, in the order they appear.
+func StatementOIDs(data []byte) ([]asn1.ObjectIdentifier, error) {
+	statements, err := parseStatements(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]asn1.ObjectIdentifier, len(statements))
+	for i, st := range statements {
+		ids[i] = st.OID
+	}
+	return ids, nil
+}
+
+// Statements is the lossless decoding of an encoded qualified statement.
+type Statements struct {
+	// Compliance is whether a QcCompliance statement is present.
+	Compliance bool
+	// Types holds the QcType statement details, e.g. QWACType.
+	Types []asn1.ObjectIdentifier
+	// Roles, CAName and CAID are decoded from the PSD2 statement.
+	Roles  []Role
+	CAName string
+	CAID   string
+	// Limit is the QcLimitValue, or nil if absent.
+	Limit *MonetaryLimit
+	// PDS lists the locations of the QcPDS statement, if any.
+	PDS []PDSLocation
+	// Raw holds every statement, recognized or not, in the order they appear.
+	Raw []RawStatement
+}
+
+// ExtractAll decodes every statement of an encoded qualified statement. Unlike
+// Extract it does not require a PSD2 statement and keeps statements not
+// defined by this package in Raw.
+func ExtractAll(data []byte) (*Statements, error) {
+	statements, err := parseStatements(data)
+	if err != nil {
+		return nil, err
+	}
+
+	all := &Statements{}
+	for _, st := range statements {
+		switch {
+		case st.OID.Equal(QcComplianceOID):
+			all.Compliance = true
+		case st.OID.Equal(QcTypeOID):
+			var types []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(st.Info.FullBytes, &types); err != nil {
+				return nil, fmt.Errorf("failed to decode QcType: %v", err)
+			}
+			all.Types = append(all.Types, types...)
+		case st.OID.Equal(PSD2OID):
+			var info rolesInfo
+			if _, err := asn1.Unmarshal(st.Info.FullBytes, &info); err != nil {
+				return nil, fmt.Errorf("failed to decode eIDAS: %v", err)
+			}
+			all.Roles = make([]Role, 0, len(info.Roles))
+			for _, role := range info.Roles {
+				all.Roles = append(all.Roles, role.Role)
+			}
+			all.CAName, all.CAID = info.CAName, info.CAID
+		case st.OID.Equal(QcLimitValueOID):
+			limit, err := decodeLimit(st.Info.FullBytes)
+			if err != nil {
+				return nil, err
+			}
+			all.Limit = limit
+		case st.OID.Equal(QcPDSOID):
+			pds, err := decodePDS(st.Info.FullBytes)
+			if err != nil {
+				return nil, err
+			}
+			all.PDS = pds
+		}
+		all.Raw = append(all.Raw, RawStatement{ID: st.OID, Value: st.Info.FullBytes})
+	}
+	return all, nil
+}
+
+func parseStatements(data []byte) ([]statement, error) {
+	var statements []statement
+	if _, err := asn1.Unmarshal(data, &statements); err != nil {
+		return nil, fmt.Errorf("failed to decode eIDAS: %v", err)
+	}
+	return statements, nil
 }
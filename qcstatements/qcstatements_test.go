@@ -1,8 +1,14 @@
 package qcstatements
 
 import (
+	"bytes"
+	"encoding/asn1"
 	"encoding/hex"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -157,3 +163,860 @@ func TestQSEAL(t *testing.T) {
 		}
 	}
 }
+
+func TestLimitValue(t *testing.T) {
+	limit := MonetaryLimit{Amount: 1000000, Exponent: 0, Currency: "EUR"}
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(limit))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ExtractLimit(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("Expected limit value but got nil")
+	}
+	if *got != limit {
+		t.Errorf("Expected limit: %+v but got %+v", limit, *got)
+	}
+	all, err := ExtractAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all.Limit == nil || *all.Limit != limit {
+		t.Errorf("Expected ExtractAll limit: %+v but got %+v", limit, all.Limit)
+	}
+
+	roles, name, id, err := Extract(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != RoleAccountInformation {
+		t.Errorf("Expected roles: [%s] but got %v", RoleAccountInformation, roles)
+	}
+	if name != defaultCA.Name || id != defaultCA.ID {
+		t.Errorf("Expected CA: %v but got %s %s", defaultCA, name, id)
+	}
+}
+
+func TestLimitValueExponent(t *testing.T) {
+	for _, test := range []struct {
+		limit MonetaryLimit
+		value string
+	}{
+		{MonetaryLimit{Amount: 12345, Exponent: -2, Currency: "EUR"}, "123.45"},
+		{MonetaryLimit{Amount: -5, Exponent: -3, Currency: "EUR"}, "-0.005"},
+		{MonetaryLimit{Amount: math.MaxInt64, Exponent: 6, Currency: "GBP"}, "9223372036854775807000000"},
+	} {
+		d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(test.limit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ExtractLimit(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || *got != test.limit {
+			t.Fatalf("Expected limit: %+v but got %+v", test.limit, got)
+		}
+		value, err := got.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := new(big.Rat).SetString(test.value)
+		if value.Cmp(want) != 0 {
+			t.Errorf("Expected value: %s but got %s", test.value, value.RatString())
+		}
+	}
+}
+
+func TestLimitValueNumericCurrency(t *testing.T) {
+	info, err := asn1.Marshal(struct {
+		Currency int
+		Amount   int64
+		Exponent int
+	}{978, 250, -2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithStatement(QcLimitValueOID, info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExtractLimit(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MonetaryLimit{Amount: 250, Exponent: -2, Currency: "978", NumericCurrency: true}
+	if got == nil || *got != want {
+		t.Fatalf("Expected limit: %+v but got %+v", want, got)
+	}
+
+	// Serializing the extracted limit reproduces the numeric encoding.
+	again, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(*got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, d) {
+		t.Errorf("Expected DER: %x but got %x", d, again)
+	}
+
+	for _, currency := range []string{"000", "97", "9a8", "+78"} {
+		if _, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(MonetaryLimit{Amount: 1, Currency: currency, NumericCurrency: true})); err == nil {
+			t.Errorf("Expected error for numeric currency %q", currency)
+		}
+	}
+}
+
+func TestLimitValueAlphabeticCurrencyRoundTrip(t *testing.T) {
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(MonetaryLimit{Amount: 1000000, Currency: "EUR"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExtractLimit(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.NumericCurrency {
+		t.Error("Expected alphabetic currency")
+	}
+	again, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(*got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, d) {
+		t.Errorf("Expected DER: %x but got %x", d, again)
+	}
+}
+
+func TestLimitValueAmountRange(t *testing.T) {
+	for _, tc := range []struct {
+		Amount   string
+		Expected error
+	}{
+		{"9223372036854775807", nil},
+		{"-9223372036854775808", nil},
+		{"9223372036854775808", ErrLimitAmountRange},
+		{"-9223372036854775809", ErrLimitAmountRange},
+		{"100000000000000000000", ErrLimitAmountRange},
+	} {
+		amount, _ := new(big.Int).SetString(tc.Amount, 10)
+		info, err := asn1.Marshal(struct {
+			Currency string `asn1:"printable"`
+			Amount   *big.Int
+			Exponent int
+		}{"EUR", amount, 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithStatement(QcLimitValueOID, info))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ExtractLimit(d)
+		if err != tc.Expected {
+			t.Errorf("Expected error: %v for amount %s but got %v", tc.Expected, tc.Amount, err)
+		} else if err == nil && fmt.Sprint(got.Amount) != tc.Amount {
+			t.Errorf("Expected amount: %s but got %d", tc.Amount, got.Amount)
+		}
+	}
+}
+
+func TestLimitValueHostileExponent(t *testing.T) {
+	info, err := asn1.Marshal(struct {
+		Currency string `asn1:"printable"`
+		Amount   int64
+		Exponent int
+	}{"EUR", 1, math.MaxInt32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithStatement(QcLimitValueOID, info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractLimit(d); err == nil {
+		t.Error("Expected error for out of range exponent")
+	}
+	if _, err := (MonetaryLimit{Amount: 1, Exponent: -math.MaxInt32, Currency: "EUR"}).Value(); err == nil {
+		t.Error("Expected error computing value with out of range exponent")
+	}
+}
+
+func TestLimitValueExponentBounds(t *testing.T) {
+	for _, exp := range []int{-maxLimitExponent, maxLimitExponent} {
+		limit := MonetaryLimit{Amount: 1, Exponent: exp, Currency: "EUR"}
+		d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(limit))
+		if err != nil {
+			t.Fatalf("Expected exponent %d to serialize but got %v", exp, err)
+		}
+		got, err := ExtractLimit(d)
+		if err != nil {
+			t.Fatalf("Expected exponent %d to extract but got %v", exp, err)
+		}
+		if *got != limit {
+			t.Errorf("Expected limit: %+v but got %+v", limit, *got)
+		}
+	}
+
+	for _, exp := range []int{-maxLimitExponent - 1, maxLimitExponent + 1} {
+		limit := MonetaryLimit{Amount: 1, Exponent: exp, Currency: "EUR"}
+		if _, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(limit)); err == nil {
+			t.Errorf("Expected error serializing exponent %d", exp)
+		}
+		info, err := asn1.Marshal(struct {
+			Currency string `asn1:"printable"`
+			Amount   int64
+			Exponent int
+		}{"EUR", 1, exp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithStatement(QcLimitValueOID, info))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ExtractLimit(d); err == nil {
+			t.Errorf("Expected error extracting exponent %d", exp)
+		}
+	}
+}
+
+func TestLimitValueAbsent(t *testing.T) {
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExtractLimit(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("Expected no limit value but got %+v", *got)
+	}
+}
+
+func TestLimitValueInvalidCurrency(t *testing.T) {
+	_, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithLimitValue(MonetaryLimit{Amount: 1, Currency: "EURO"}))
+	if err == nil {
+		t.Error("Expected error for invalid currency code")
+	}
+}
+
+func TestCustomStatement(t *testing.T) {
+	id := asn1.ObjectIdentifier{1, 2, 3, 4, 5}
+	value, err := asn1.MarshalWithParams("national scheme", "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QWACType, WithStatement(id, value), WithStatement(QcSSCDOID, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	custom, err := ExtractCustom(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(custom) != 2 {
+		t.Fatalf("Expected 2 custom statements but got %d", len(custom))
+	}
+	if !custom[0].ID.Equal(id) || !bytes.Equal(custom[0].Value, value) {
+		t.Errorf("Expected statement: %v %x but got %v %x", id, value, custom[0].ID, custom[0].Value)
+	}
+	if !custom[1].ID.Equal(QcSSCDOID) || custom[1].Value != nil {
+		t.Errorf("Expected statement: %v without value but got %v %x", QcSSCDOID, custom[1].ID, custom[1].Value)
+	}
+
+	roles, _, _, err := Extract(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != RoleAccountInformation {
+		t.Errorf("Expected roles: [%s] but got %v", RoleAccountInformation, roles)
+	}
+
+	if _, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QWACType, WithStatement(id, []byte{0x0c, 0x05})); err == nil {
+		t.Error("Expected error for malformed statement value")
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	vendor := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	value, err := asn1.Marshal(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Serialize([]Role{RolePaymentInitiation}, defaultCA, QSEALType, WithStatement(QcSSCDOID, nil), WithStatement(vendor, value))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := ExtractAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Types) != 1 || !all.Types[0].Equal(QSEALType) {
+		t.Errorf("Expected types: [%v] but got %v", QSEALType, all.Types)
+	}
+	if len(all.Roles) != 1 || all.Roles[0] != RolePaymentInitiation {
+		t.Errorf("Expected roles: [%s] but got %v", RolePaymentInitiation, all.Roles)
+	}
+	if all.CAName != defaultCA.Name || all.CAID != defaultCA.ID {
+		t.Errorf("Expected CA: %v but got %s %s", defaultCA, all.CAName, all.CAID)
+	}
+	if all.Limit != nil {
+		t.Errorf("Expected no limit value but got %+v", *all.Limit)
+	}
+
+	expected := []asn1.ObjectIdentifier{QcTypeOID, PSD2OID, QcSSCDOID, vendor}
+	if len(all.Raw) != len(expected) {
+		t.Fatalf("Expected %d statements but got %d", len(expected), len(all.Raw))
+	}
+	for i, id := range expected {
+		if !all.Raw[i].ID.Equal(id) {
+			t.Errorf("Expected statement %d: %v but got %v", i, id, all.Raw[i].ID)
+		}
+	}
+	if all.Raw[2].Value != nil {
+		t.Errorf("Expected QcSSCD without value but got %x", all.Raw[2].Value)
+	}
+	if !bytes.Equal(all.Raw[3].Value, value) {
+		t.Errorf("Expected vendor value: %x but got %x", value, all.Raw[3].Value)
+	}
+}
+
+func TestSerializePSD2Only(t *testing.T) {
+	d, err := SerializePSD2Only([]Role{RoleAccountServicing}, defaultCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The PSD2 statement from the PSP_AS test vector.
+	expected := "30440606040081982702303a301330110607040081982701010c065053505f41530c1b46696e616e6369616c20436f6e6475637420417574686f726974790c0647422d464341"
+	if enc := hex.EncodeToString(d); enc != expected {
+		t.Errorf("Mismatch with PSP_AS: %s", enc)
+	}
+
+	var st statement
+	rest, err := asn1.Unmarshal(d, &st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("Expected no trailing bytes but got %d", len(rest))
+	}
+	if !st.OID.Equal(PSD2OID) {
+		t.Errorf("Expected statement: %v but got %v", PSD2OID, st.OID)
+	}
+	for _, id := range []asn1.ObjectIdentifier{QcComplianceOID, QcTypeOID} {
+		enc, err := asn1.Marshal(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(d, enc) {
+			t.Errorf("Expected no %v statement", id)
+		}
+	}
+
+	if _, err := SerializePSD2Only([]Role{"PSP_XX"}, defaultCA); err == nil {
+		t.Error("Expected error for unknown role")
+	}
+}
+
+func TestStatementOIDs(t *testing.T) {
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QWACType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := StatementOIDs(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Serialize follows the ETSI CSR profile examples, which carry no
+	// QcCompliance statement unless asked for.
+	expected := []asn1.ObjectIdentifier{QcTypeOID, PSD2OID}
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("Expected OIDs: %v but got %v", expected, ids)
+	}
+
+	d, err = Serialize([]Role{RoleAccountInformation}, defaultCA, QWACType, WithCompliance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err = StatementOIDs(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []asn1.ObjectIdentifier{QcComplianceOID, QcTypeOID, PSD2OID}
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Errorf("Expected OIDs: %v but got %v", expected, ids)
+	}
+	all, err := ExtractAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !all.Compliance {
+		t.Error("Expected ExtractAll to report QcCompliance")
+	}
+	if custom, err := ExtractCustom(d); err != nil || len(custom) != 0 {
+		t.Errorf("Expected no custom statements but got %v, %v", custom, err)
+	}
+	if _, _, _, err := ExtractStrict(d); err != nil {
+		t.Errorf("Expected ExtractStrict to accept QcCompliance but got %v", err)
+	}
+
+	if _, err := StatementOIDs([]byte{0x30, 0x05}); err == nil {
+		t.Error("Expected error for truncated data")
+	}
+}
+
+// TestStatementIdentifiers checks the statement identifiers against ETSI EN
+// 319 412-5 Section 5 and ETSI TS 119 495 Section 5.1.
+func TestStatementIdentifiers(t *testing.T) {
+	for _, tc := range []struct {
+		Name string
+		ID   asn1.ObjectIdentifier
+		OID  string
+	}{
+		{"QcCompliance", QcComplianceOID, "0.4.0.1862.1.1"},
+		{"QcLimitValue", QcLimitValueOID, "0.4.0.1862.1.2"},
+		{"QcRetentionPeriod", QcRetentionPeriodOID, "0.4.0.1862.1.3"},
+		{"QcSSCD", QcSSCDOID, "0.4.0.1862.1.4"},
+		{"QcPDS", QcPDSOID, "0.4.0.1862.1.5"},
+		{"QcType", QcTypeOID, "0.4.0.1862.1.6"},
+		{"PSD2", PSD2OID, "0.4.0.19495.2"},
+	} {
+		if tc.ID.String() != tc.OID {
+			t.Errorf("Expected %s OID: %s but got %s", tc.Name, tc.OID, tc.ID)
+		}
+	}
+}
+
+// TestRoleOIDs checks each role against the RoleOfPSP identifiers and names
+// of ETSI TS 119 495 Section 5.1.
+func TestRoleOIDs(t *testing.T) {
+	for _, tc := range []struct {
+		Role Role
+		OID  string
+		Name string
+	}{
+		{RoleAccountServicing, "0.4.0.19495.1.1", "PSP_AS"},
+		{RolePaymentInitiation, "0.4.0.19495.1.2", "PSP_PI"},
+		{RoleAccountInformation, "0.4.0.19495.1.3", "PSP_AI"},
+		{RolePaymentInstruments, "0.4.0.19495.1.4", "PSP_IC"},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			d, err := SerializePSD2Only([]Role{tc.Role}, defaultCA)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var st qcStatement
+			if _, err := asn1.Unmarshal(d, &st); err != nil {
+				t.Fatal(err)
+			}
+			if len(st.RolesInfo.Roles) != 1 {
+				t.Fatalf("Expected 1 role but got %d", len(st.RolesInfo.Roles))
+			}
+			r := st.RolesInfo.Roles[0]
+			if r.OID.String() != tc.OID {
+				t.Errorf("Expected OID: %s but got %s", tc.OID, r.OID)
+			}
+			if string(r.Role) != tc.Name {
+				t.Errorf("Expected name: %s but got %s", tc.Name, r.Role)
+			}
+
+			if got := tc.Role.OID().String(); got != tc.OID {
+				t.Errorf("Expected OID: %s but got %s", tc.OID, got)
+			}
+			role, err := RoleFromOID(tc.Role.OID())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if role != tc.Role {
+				t.Errorf("Expected role: %s but got %s", tc.Role, role)
+			}
+		})
+	}
+
+	if oid := Role("PSP_XX").OID(); oid != nil {
+		t.Errorf("Expected no OID for unknown role but got %v", oid)
+	}
+	if _, err := RoleFromOID(asn1.ObjectIdentifier{0, 4, 0, 19495, 1, 5}); err == nil {
+		t.Error("Expected error for unknown role OID")
+	}
+}
+
+func TestRoleOrder(t *testing.T) {
+	roles := []Role{RolePaymentInstruments, RoleAccountInformation, RoleAccountServicing, RolePaymentInitiation}
+	d, err := Serialize(roles, defaultCA, QWACType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, _, err := Extract(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(roles) {
+		t.Errorf("Expected roles: %v but got %v", roles, got)
+	}
+}
+
+func TestMultipleTypes(t *testing.T) {
+	types := []asn1.ObjectIdentifier{QESIGNType, QSEALType}
+	d, err := SerializeTypes([]Role{RoleAccountInformation}, defaultCA, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ExtractTypes(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(types) {
+		t.Errorf("Expected types: %v but got %v", types, got)
+	}
+	if _, err := SerializeTypes([]Role{RoleAccountInformation}, defaultCA, nil); err == nil {
+		t.Error("Expected error for no types")
+	}
+}
+
+func TestRoleFromString(t *testing.T) {
+	for _, tc := range []struct {
+		In       string
+		Expected Role
+	}{
+		{"AIS", RoleAccountInformation},
+		{"PIS", RolePaymentInitiation},
+		{"ASPSP", RoleAccountServicing},
+		{"PIISP", RolePaymentInstruments},
+		{"ais", RoleAccountInformation},
+		{"Account Information", RoleAccountInformation},
+		{"Payment Initiation", RolePaymentInitiation},
+		{"Account Servicing", RoleAccountServicing},
+		{"Issuing of Card-Based Payment Instruments", RolePaymentInstruments},
+		{"PSP_AI", RoleAccountInformation},
+		{"PSP_PI", RolePaymentInitiation},
+		{"PSP_AS", RoleAccountServicing},
+		{"PSP_IC", RolePaymentInstruments},
+	} {
+		t.Run(tc.In, func(t *testing.T) {
+			r, err := RoleFromString(tc.In)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r != tc.Expected {
+				t.Errorf("Expected role: %s but got %s", tc.Expected, r)
+			}
+		})
+	}
+
+	if _, err := RoleFromString("FOO"); err == nil {
+		t.Error("Expected error for unknown role")
+	}
+}
+
+func TestRoleString(t *testing.T) {
+	if s := RoleAccountInformation.String(); s != "Account Information" {
+		t.Errorf("Expected Account Information but got %s", s)
+	}
+	if s := Role("PSP_XX").String(); s != "PSP_XX" {
+		t.Errorf("Expected PSP_XX but got %s", s)
+	}
+}
+
+func TestSupportedCountries(t *testing.T) {
+	countries := SupportedCountries()
+	if !sort.StringsAreSorted(countries) {
+		t.Errorf("Expected sorted countries but got %v", countries)
+	}
+	found := false
+	for _, c := range countries {
+		if c == "GB" {
+			found = true
+		}
+		if _, err := CompetentAuthorityForCountryCode(c); err != nil {
+			t.Errorf("Expected competent authority for %s: %v", c, err)
+		}
+	}
+	if !found {
+		t.Errorf("Expected GB in %v", countries)
+	}
+}
+
+func TestCompetentAuthorityByID(t *testing.T) {
+	for _, tc := range []struct {
+		ID      string
+		Country string
+		Name    string
+	}{
+		{"GB-FCA", "GB", "Financial Conduct Authority"},
+		{"DE-BAFIN", "DE", "Federal Financial Supervisory Authority"},
+		{"IE-CBI", "IE", "Central Bank of Ireland"},
+		{"FR-ACPR", "FR", "Prudential Supervisory and Resolution Authority"},
+	} {
+		t.Run(tc.ID, func(t *testing.T) {
+			ca, err := CompetentAuthorityByID(tc.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ca.Country != tc.Country {
+				t.Errorf("Expected country: %s but got %s", tc.Country, ca.Country)
+			}
+			if ca.Name != tc.Name {
+				t.Errorf("Expected name: %s but got %s", tc.Name, ca.Name)
+			}
+		})
+	}
+
+	if _, err := CompetentAuthorityByID("XX-FOO"); err == nil {
+		t.Error("Expected error for unknown ID")
+	}
+}
+
+func TestCompetentAuthorityIsCopy(t *testing.T) {
+	ca, err := CompetentAuthorityForCountryCode("GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.Name = "Mutated"
+	ca.ID = "XX-FOO"
+
+	byID, err := CompetentAuthorityByID("GB-FCA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID.Name = "Mutated"
+
+	ca, err = CompetentAuthorityForCountryCode("GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ca.Name != "Financial Conduct Authority" || ca.ID != "GB-FCA" {
+		t.Errorf("Expected unmodified authority but got %+v", *ca)
+	}
+}
+
+func BenchmarkCompetentAuthorityForCountryCode(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := CompetentAuthorityForCountryCode("GB"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompetentAuthorityByID(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := CompetentAuthorityByID("GB-FCA"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	ca, err := CompetentAuthorityForCountryCode("DE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for lang, expected := range map[string]string{
+		"de": "Bundesanstalt für Finanzdienstleistungsaufsicht",
+		"fr": "Federal Financial Supervisory Authority",
+	} {
+		t.Run(lang, func(t *testing.T) {
+			d, err := Serialize([]Role{RoleAccountInformation}, *ca, QWACType, WithLanguage(lang))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, name, _, err := Extract(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != expected {
+				t.Errorf("Expected name: %s but got %s", expected, name)
+			}
+		})
+	}
+
+	ca.LocalizedNames["de"] = "Mutated"
+	if ca, _ := CompetentAuthorityForCountryCode("DE"); ca.LocalizedName("de") == "Mutated" {
+		t.Error("Expected localized names to be copied")
+	}
+}
+
+func TestExtractTypes(t *testing.T) {
+	for _, qcType := range []asn1.ObjectIdentifier{QWACType, QSEALType} {
+		d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, qcType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ExtractTypes(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || !got[0].Equal(qcType) {
+			t.Errorf("Expected QcType: [%v] but got %v", qcType, got)
+		}
+	}
+}
+
+func TestSerializeToExtension(t *testing.T) {
+	ext, err := SerializeToExtension([]Role{RoleAccountServicing}, defaultCA, QWACType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ext.Id.Equal(ExtensionID) {
+		t.Errorf("Expected extension ID: %v but got %v", ExtensionID, ext.Id)
+	}
+	if ext.Critical {
+		t.Error("Expected non-critical extension")
+	}
+	expected := "305b3013060604008e4601063009060704008e4601060330440606040081982702303a301330110607040081982701010c065053505f41530c1b46696e616e6369616c20436f6e6475637420417574686f726974790c0647422d464341"
+	if enc := hex.EncodeToString(ext.Value); enc != expected {
+		t.Errorf("Mismatch with PSP_AS: %s", enc)
+	}
+}
+
+func TestExtractStrict(t *testing.T) {
+	valid, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QWACType, WithLimitValue(MonetaryLimit{Amount: 100, Currency: "EUR"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, name, id, err := ExtractStrict(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != RoleAccountInformation || name != defaultCA.Name || id != defaultCA.ID {
+		t.Errorf("Unexpected result: %v %s %s", roles, name, id)
+	}
+
+	unknown, err := asn1.Marshal([]statement{{
+		OID:  asn1.ObjectIdentifier{1, 2, 3, 4},
+		Info: asn1.RawValue{FullBytes: []byte{0x05, 0x00}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated":         valid[:len(valid)-4],
+		"padded":            append(append([]byte{}, valid...), 0x00, 0x00),
+		"unknown statement": unknown,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, _, err := ExtractStrict(data); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+
+	// The lenient Extract tolerates trailing bytes.
+	if _, _, _, err := Extract(append(append([]byte{}, valid...), 0x00, 0x00)); err != nil {
+		t.Errorf("Expected lenient Extract to succeed: %v", err)
+	}
+}
+
+func TestExtractStrictKnownStatements(t *testing.T) {
+	years, err := asn1.Marshal(15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		Name     string
+		ID       asn1.ObjectIdentifier
+		Value    []byte
+		Expected bool
+	}{
+		{"QcSSCD", QcSSCDOID, nil, true},
+		{"QcSSCD with statementInfo", QcSSCDOID, years, false},
+		{"QcRetentionPeriod", QcRetentionPeriodOID, years, true},
+		{"QcRetentionPeriod without statementInfo", QcRetentionPeriodOID, nil, false},
+		{"QcRetentionPeriod with a string", QcRetentionPeriodOID, []byte{0x0c, 0x02, '1', '5'}, false},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithStatement(tc.ID, tc.Value))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, _, err = ExtractStrict(d)
+			if tc.Expected && err != nil {
+				t.Errorf("Expected no error but got %v", err)
+			} else if !tc.Expected && err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestNonASCIICompetentAuthorityName(t *testing.T) {
+	ca := CompetentAuthority{
+		Name: "Bundesanstalt für Finanzdienstleistungsaufsicht",
+		ID:   "DE-BAFIN",
+	}
+	d, err := Serialize([]Role{RoleAccountInformation}, ca, QWACType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, name, id, err := Extract(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != ca.Name || id != ca.ID {
+		t.Errorf("Expected CA: %v but got %s %s", ca, name, id)
+	}
+
+	// The name must be encoded as a UTF8String (tag 12).
+	encodedName, err := asn1.MarshalWithParams(ca.Name, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(d, encodedName) {
+		t.Error("Expected CA name to be encoded as a UTF8String")
+	}
+
+	if _, err := Serialize([]Role{RoleAccountInformation}, CompetentAuthority{Name: "\xff", ID: "DE-BAFIN"}, QWACType); err == nil {
+		t.Error("Expected error for invalid UTF-8 name")
+	}
+}
+
+func TestPDSLocations(t *testing.T) {
+	locations := []PDSLocation{
+		{URL: "https://example.com/pds_en.pdf", Language: "en"},
+		{URL: "https://example.com/pds_de.pdf", Language: "de"},
+	}
+	d, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithPDSLocations(locations...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := ExtractAll(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all.PDS, locations) {
+		t.Errorf("Expected locations: %v but got %v", locations, all.PDS)
+	}
+	custom, err := ExtractCustom(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(custom) != 0 {
+		t.Errorf("Expected no custom statements but got %v", custom)
+	}
+	roles, _, _, err := ExtractStrict(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != RoleAccountInformation {
+		t.Errorf("Expected roles: [%s] but got %v", RoleAccountInformation, roles)
+	}
+
+	for _, l := range []PDSLocation{
+		{URL: "https://example.com/pds_en.pdf", Language: "english"},
+		{URL: "https://example.com/pds_en.pdf", Language: "e1"},
+		{URL: "", Language: "en"},
+		{URL: "https://bücher.example/pds.pdf", Language: "de"},
+	} {
+		if _, err := Serialize([]Role{RoleAccountInformation}, defaultCA, QSEALType, WithPDSLocations(l)); err == nil {
+			t.Errorf("Expected error for %v", l)
+		}
+	}
+}
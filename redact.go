@@ -0,0 +1,48 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+)
+
+// oidExtensionCertificatePolicies is the certificatePolicies extension ID.
+var oidExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+
+// RedactEIDASExtensions returns a copy of cert without the qcStatements and
+// certificatePolicies extensions, e.g. for logging certificate metadata. The
+// raw DER encodings of the whole certificate and its TBSCertificate, which
+// still contain the extensions, and the signature are cleared too. cert is
+// not modified.
+func RedactEIDASExtensions(cert *x509.Certificate) *x509.Certificate {
+	c := *cert
+	c.Raw = nil
+	c.RawTBSCertificate = nil
+	c.Signature = nil
+	c.Extensions = redactExtensions(cert.Extensions)
+	c.ExtraExtensions = redactExtensions(cert.ExtraExtensions)
+	c.PolicyIdentifiers = nil
+	c.Policies = nil
+
+	c.UnhandledCriticalExtensions = nil
+	for _, id := range cert.UnhandledCriticalExtensions {
+		if !isEIDASExtension(id) {
+			c.UnhandledCriticalExtensions = append(c.UnhandledCriticalExtensions, id)
+		}
+	}
+	return &c
+}
+
+func redactExtensions(exts []pkix.Extension) []pkix.Extension {
+	var out []pkix.Extension
+	for _, ext := range exts {
+		if !isEIDASExtension(ext.Id) {
+			out = append(out, ext)
+		}
+	}
+	return out
+}
+
+func isEIDASExtension(id asn1.ObjectIdentifier) bool {
+	return id.Equal(QCStatementsExt) || id.Equal(oidExtensionCertificatePolicies)
+}
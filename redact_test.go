@@ -0,0 +1,39 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedactEIDASExtensions(t *testing.T) {
+	Convey("redacted certificate", t, func() {
+		root, rootKey := testCA("Root CA", nil, nil)
+		csr, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithQCStatementsCritical(true))
+		So(err, ShouldBeNil)
+		der, err := SignCSR(csr, root, rootKey)
+		So(err, ShouldBeNil)
+		cert, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+
+		redacted := RedactEIDASExtensions(cert)
+		So(findQCStatements(redacted.Extensions), ShouldBeNil)
+		So(redacted.UnhandledCriticalExtensions, ShouldBeEmpty)
+		So(redacted.Raw, ShouldBeNil)
+		So(redacted.RawTBSCertificate, ShouldBeNil)
+		So(len(redacted.Extensions), ShouldEqual, len(cert.Extensions)-1)
+
+		So(redacted.RawSubject, ShouldResemble, cert.RawSubject)
+		So(redacted.Subject.CommonName, ShouldEqual, "Foo Name")
+		So(redacted.SerialNumber, ShouldEqual, cert.SerialNumber)
+		So(redacted.KeyUsage, ShouldEqual, cert.KeyUsage)
+		So(redacted.SubjectKeyId, ShouldResemble, cert.SubjectKeyId)
+		So(redacted.PublicKey, ShouldResemble, cert.PublicKey)
+
+		// The original is untouched.
+		So(findQCStatements(cert.Extensions), ShouldNotBeNil)
+		So(cert.Raw, ShouldResemble, der)
+	})
+}
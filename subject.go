@@ -0,0 +1,84 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"strings"
+)
+
+// attributeNames are the names SubjectString uses for subject attribute types.
+// Those from RFC 4514 Section 3 match pkix.Name.String; the rest use their
+// RFC 4519 or ETSI EN 319 412-1 names.
+var attributeNames = map[string]string{
+	oidCountryCode.String():         "C",
+	oidOrganizationName.String():    "O",
+	oidCommonName.String():          "CN",
+	"2.5.4.11":                      "OU",
+	"2.5.4.7":                       "L",
+	"2.5.4.8":                       "ST",
+	"2.5.4.9":                       "STREET",
+	"2.5.4.17":                      "POSTALCODE",
+	oidSerialNumber.String():        "SERIALNUMBER",
+	oidOrganizationID.String():      "organizationIdentifier",
+	oidBusinessCategory.String():    "businessCategory",
+	oidGivenName.String():           "givenName",
+	oidSurname.String():             "SN",
+	oidJurisdictionCountry.String(): "jurisdictionC",
+}
+
+// SubjectString renders the subject of csr as an RFC 4514 string, with the
+// most specific attribute first. Unlike pkix.Name.String it names the
+// organizationIdentifier attribute (2.5.4.97) and the other attributes used by
+// eIDAS certificates. Attributes it doesn't know are rendered as the dotted
+// OID and the hex encoded DER value.
+func SubjectString(csr *x509.CertificateRequest) string {
+	var rdns pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(csr.RawSubject, &rdns); err != nil || len(rest) != 0 {
+		return ""
+	}
+
+	var parts []string
+	for i := len(rdns) - 1; i >= 0; i-- {
+		var attrs []string
+		for _, atv := range rdns[i] {
+			attrs = append(attrs, attributeString(atv))
+		}
+		parts = append(parts, strings.Join(attrs, "+"))
+	}
+	return strings.Join(parts, ",")
+}
+
+func attributeString(atv pkix.AttributeTypeAndValue) string {
+	name, known := attributeNames[atv.Type.String()]
+	value, isString := atv.Value.(string)
+	if !known || !isString {
+		der, err := asn1.Marshal(atv.Value)
+		if err != nil {
+			return atv.Type.String() + "="
+		}
+		return atv.Type.String() + "=#" + hex.EncodeToString(der)
+	}
+	return name + "=" + escapeAttributeValue(value)
+}
+
+// escapeAttributeValue escapes a string attribute value as described in RFC
+// 4514 Section 2.4.
+func escapeAttributeValue(s string) string {
+	var b strings.Builder
+	for i, c := range s {
+		switch {
+		case c == ',' || c == '+' || c == '"' || c == '\\' || c == '<' || c == '>' || c == ';',
+			c == ' ' && (i == 0 || i == len(s)-1),
+			c == '#' && i == 0:
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c == 0:
+			b.WriteString("\\00")
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubjectString(t *testing.T) {
+	Convey("Subject of a generated CSR", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType)
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(SubjectString(csr), ShouldEqual, "CN=Foo Name,organizationIdentifier=PSDGB-FCA-123456,O=Foo Org,C=GB")
+	})
+
+	Convey("Subject with special characters and unknown attributes", t, func() {
+		subject := pkix.Name{
+			Country:      []string{"GB"},
+			Organization: []string{"Foo, Bar + Baz"},
+			CommonName:   " #Foo ",
+			ExtraNames: []pkix.AttributeTypeAndValue{
+				{Type: oidOrganizationID, Value: "PSDGB-FCA-123456"},
+				{Type: asn1.ObjectIdentifier{1, 2, 3}, Value: "x"},
+			},
+		}
+		data, _, err := GenerateCSR("GB", "", "", "", []qcstatements.Role{qcstatements.RoleAccountInformation}, qcstatements.QSEALType, WithRawSubject(subject))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(SubjectString(csr), ShouldEqual, `1.2.3=#130178,organizationIdentifier=PSDGB-FCA-123456,CN=\ #Foo\ ,O=Foo\, Bar \+ Baz,C=GB`)
+	})
+}
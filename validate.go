@@ -0,0 +1,116 @@
+package eidas
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"github.com/apple/eidas/internal/pkcs10"
+	"github.com/apple/eidas/qcstatements"
+)
+
+// ValidateConsistency checks that the QcType declared in the certificate's
+// qcStatements matches its key usage and extended key usage: a QWAC must allow
+// DigitalSignature and TLS authentication, a QSEAL must allow ContentCommitment
+// and must not allow TLS authentication.
+func ValidateConsistency(cert *x509.Certificate) error {
+	qc := findQCStatements(cert.Extensions)
+	if qc == nil {
+		return ErrNoQCStatements
+	}
+	types, err := qcstatements.ExtractTypes(qc)
+	if err != nil {
+		return err
+	}
+	t, err := psd2Type(types)
+	if err != nil {
+		return err
+	}
+
+	tls := hasExtKeyUsage(cert, x509.ExtKeyUsageServerAuth) || hasExtKeyUsage(cert, x509.ExtKeyUsageClientAuth)
+	switch {
+	case t.Equal(qcstatements.QWACType):
+		if cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+			return errors.New("QWAC certificate does not have DigitalSignature key usage")
+		}
+		if !tls {
+			return errors.New("QWAC certificate does not have TLS extended key usage")
+		}
+	case t.Equal(qcstatements.QSEALType):
+		if cert.KeyUsage&x509.KeyUsageContentCommitment == 0 {
+			return errors.New("QSEAL certificate does not have ContentCommitment key usage")
+		}
+		if tls {
+			return errors.New("QSEAL certificate has TLS extended key usage")
+		}
+	}
+	return nil
+}
+
+// VerifyAgainstRoots verifies that cert chains to one of the given roots, e.g.
+// the CA certificates of an eIDAS trusted list, through the given
+// intermediates, which may be nil. cert must pass ValidateConsistency and, if
+// it is a QWAC, the whole chain must be valid for TLS authentication. The
+// trusted list itself is not fetched.
+func VerifyAgainstRoots(cert *x509.Certificate, roots *x509.CertPool, intermediates *x509.CertPool) error {
+	if err := ValidateConsistency(cert); err != nil {
+		return err
+	}
+	// ValidateConsistency has checked the QcTypes are consistent.
+	types, _ := qcstatements.ExtractTypes(findQCStatements(cert.Extensions))
+	t, _ := psd2Type(types)
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if t.Equal(qcstatements.QWACType) {
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+	// The qcStatements extension has been processed above, so it mustn't fail
+	// verification if the CA marked it critical.
+	leaf := *cert
+	leaf.UnhandledCriticalExtensions = nil
+	for _, id := range cert.UnhandledCriticalExtensions {
+		if !id.Equal(QCStatementsExt) {
+			leaf.UnhandledCriticalExtensions = append(leaf.UnhandledCriticalExtensions, id)
+		}
+	}
+	if _, err := leaf.Verify(opts); err != nil {
+		return fmt.Errorf("eidas: failed to verify certificate: %v", err)
+	}
+	return nil
+}
+
+// ValidateCSRAttributes checks that every attribute of csr is either an
+// extensionRequest or has one of the allowed types, so that e.g. a
+// challengePassword which wasn't asked for is rejected. crypto/x509 drops
+// attributes it can't represent, so they are decoded from the raw request.
+func ValidateCSRAttributes(csr *x509.CertificateRequest, allowed []asn1.ObjectIdentifier) error {
+	var tbs pkcs10.TBSCertificateRequest
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &tbs); err != nil {
+		return fmt.Errorf("failed to parse csr: %v", err)
+	}
+	for _, raw := range tbs.RawAttributes {
+		var attr pkcs10.Attribute
+		if _, err := asn1.Unmarshal(raw.FullBytes, &attr); err != nil {
+			return fmt.Errorf("failed to parse csr attribute: %v", err)
+		}
+		if attr.Type.Equal(pkcs10.OIDExtensionRequest) || containsOID(allowed, attr.Type) {
+			continue
+		}
+		return fmt.Errorf("eidas: unexpected csr attribute %v", attr.Type)
+	}
+	return nil
+}
+
+func hasExtKeyUsage(cert *x509.Certificate, usage x509.ExtKeyUsage) bool {
+	for _, u := range cert.ExtKeyUsage {
+		if u == usage {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package eidas
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/apple/eidas/internal/pkcs10"
+	"github.com/apple/eidas/qcstatements"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func selfSignedCert(qcType asn1.ObjectIdentifier, keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) *x509.Certificate {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	So(err, ShouldBeNil)
+	ca, err := qcstatements.CompetentAuthorityForCountryCode("GB")
+	So(err, ShouldBeNil)
+	qc, err := qcstatements.Serialize([]qcstatements.Role{qcstatements.RoleAccountInformation}, *ca, qcType)
+	So(err, ShouldBeNil)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "Foo Name"},
+		NotBefore:       time.Now(),
+		NotAfter:        time.Now().Add(time.Hour),
+		KeyUsage:        keyUsage,
+		ExtKeyUsage:     extKeyUsage,
+		ExtraExtensions: []pkix.Extension{qcStatementsExtension(qc, false)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	So(err, ShouldBeNil)
+	cert, err := x509.ParseCertificate(der)
+	So(err, ShouldBeNil)
+	return cert
+}
+
+func TestValidateConsistency(t *testing.T) {
+	Convey("consistent QWAC", t, func() {
+		cert := selfSignedCert(qcstatements.QWACType, x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth})
+		So(ValidateConsistency(cert), ShouldBeNil)
+	})
+
+	Convey("consistent QSEAL", t, func() {
+		cert := selfSignedCert(qcstatements.QSEALType, x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment, nil)
+		So(ValidateConsistency(cert), ShouldBeNil)
+	})
+
+	Convey("QSEAL with TLS extended key usage", t, func() {
+		cert := selfSignedCert(qcstatements.QSEALType, x509.KeyUsageDigitalSignature|x509.KeyUsageContentCommitment, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+		So(ValidateConsistency(cert), ShouldBeError, "QSEAL certificate has TLS extended key usage")
+	})
+
+	Convey("QSEAL without ContentCommitment", t, func() {
+		cert := selfSignedCert(qcstatements.QSEALType, x509.KeyUsageDigitalSignature, nil)
+		So(ValidateConsistency(cert), ShouldBeError, "QSEAL certificate does not have ContentCommitment key usage")
+	})
+
+	Convey("QWAC without TLS extended key usage", t, func() {
+		cert := selfSignedCert(qcstatements.QWACType, x509.KeyUsageDigitalSignature, nil)
+		So(ValidateConsistency(cert), ShouldBeError, "QWAC certificate does not have TLS extended key usage")
+	})
+}
+
+// testCA returns a CA certificate and key, self-signed if parent is nil.
+func testCA(name string, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := GenerateKey(ECP256)
+	So(err, ShouldBeNil)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	So(err, ShouldBeNil)
+	cert, err := x509.ParseCertificate(der)
+	So(err, ShouldBeNil)
+	return cert, key
+}
+
+func TestVerifyAgainstRoots(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("leaf chaining to the root", t, func() {
+		root, rootKey := testCA("Root CA", nil, nil)
+		intermediate, intermediateKey := testCA("Intermediate CA", root, rootKey)
+		roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+		roots.AddCert(root)
+		intermediates.AddCert(intermediate)
+
+		for _, qcType := range []asn1.ObjectIdentifier{qcstatements.QWACType, qcstatements.QSEALType} {
+			csr, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcType, WithSANValidation(false))
+			So(err, ShouldBeNil)
+			der, err := SignCSR(csr, intermediate, intermediateKey)
+			So(err, ShouldBeNil)
+			leaf, err := x509.ParseCertificate(der)
+			So(err, ShouldBeNil)
+
+			So(VerifyAgainstRoots(leaf, roots, intermediates), ShouldBeNil)
+			// Without the intermediate there is no chain.
+			So(VerifyAgainstRoots(leaf, roots, nil), ShouldNotBeNil)
+			// Nor with an unrelated root.
+			other, _ := testCA("Other CA", nil, nil)
+			otherRoots := x509.NewCertPool()
+			otherRoots.AddCert(other)
+			So(VerifyAgainstRoots(leaf, otherRoots, intermediates), ShouldNotBeNil)
+		}
+	})
+
+	Convey("leaf with critical qcStatements", t, func() {
+		root, rootKey := testCA("Root CA", nil, nil)
+		roots := x509.NewCertPool()
+		roots.AddCert(root)
+
+		csr, _, err := GenerateCSR("GB", "Foo Org", "PSDGB-FCA-123456", "Foo Name", roles, qcstatements.QSEALType, WithQCStatementsCritical(true))
+		So(err, ShouldBeNil)
+		der, err := SignCSR(csr, root, rootKey)
+		So(err, ShouldBeNil)
+		leaf, err := x509.ParseCertificate(der)
+		So(err, ShouldBeNil)
+		So(VerifyAgainstRoots(leaf, roots, nil), ShouldBeNil)
+		// The caller's certificate is left untouched.
+		So(leaf.UnhandledCriticalExtensions, ShouldHaveLength, 1)
+	})
+
+	Convey("inconsistent leaf", t, func() {
+		leaf := selfSignedCert(qcstatements.QWACType, x509.KeyUsageContentCommitment, nil)
+		roots := x509.NewCertPool()
+		roots.AddCert(leaf)
+		So(VerifyAgainstRoots(leaf, roots, nil), ShouldNotBeNil)
+	})
+}
+
+func TestValidateCSRAttributes(t *testing.T) {
+	roles := []qcstatements.Role{qcstatements.RoleAccountInformation}
+
+	Convey("CSR with only an extensionRequest attribute", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		So(ValidateCSRAttributes(csr, nil), ShouldBeNil)
+	})
+
+	Convey("CSR with an unexpected challengePassword attribute", t, func() {
+		data, _, err := GenerateCSR("GB", "Foo Org", "Foo Org ID", "Foo Name", roles, qcstatements.QWACType, WithChallengePassword("s3cret"), WithDNSName("example.com"))
+		So(err, ShouldBeNil)
+		csr, err := x509.ParseCertificateRequest(data)
+		So(err, ShouldBeNil)
+		err = ValidateCSRAttributes(csr, nil)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, pkcs10.OIDChallengePassword.String())
+		So(ValidateCSRAttributes(csr, []asn1.ObjectIdentifier{pkcs10.OIDChallengePassword}), ShouldBeNil)
+	})
+}